@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/cost"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fswalker"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/preprocess"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sink"
+	"github.com/pterm/pterm"
+)
+
+const (
+	// summaryOutputTokens and chunkOutputTokens are the expected output tokens of the
+	// structured output of a note and of a chunk of a long note
+	summaryOutputTokens = 150
+	chunkOutputTokens   = 300
+)
+
+// estimateCosts reads the files and estimates the calls and tokens of summarizing them,
+// by top level folder of root. Files which cannot be read are skipped, the run reports them.
+func estimateCosts(files []fswalker.FileInfo, root string, plan cost.Plan, pipeline preprocess.Pipeline) map[string]cost.Estimate {
+	folders := map[string]cost.Estimate{}
+	for _, file := range files {
+		content, err := os.ReadFile(file.Path)
+		if err != nil {
+			continue
+		}
+		text, _ := sink.StripCallout(string(content))
+
+		folder := "."
+		if rel, err := filepath.Rel(root, file.Path); err == nil {
+			if first, _, nested := strings.Cut(filepath.ToSlash(rel), "/"); nested {
+				folder = first
+			}
+		}
+		e := folders[folder]
+		e.Add(plan.Note(pipeline.Apply(text)))
+		folders[folder] = e
+	}
+	return folders
+}
+
+// printEstimate prints the estimate of every folder and the total, costs only if the price is known
+func printEstimate(folders map[string]cost.Estimate, price cost.Price, priceKnown bool) {
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	costs := func(e cost.Estimate) string {
+		if !priceKnown {
+			return "unknown"
+		}
+		return fmt.Sprintf("$%.4f", e.Cost(price))
+	}
+
+	data := pterm.TableData{{"Folder", "Notes", "API calls", "Input tokens", "Output tokens", "Costs"}}
+	var total cost.Estimate
+	for _, name := range names {
+		e := folders[name]
+		total.Add(e)
+		data = append(data, []string{name, fmt.Sprint(e.Notes), fmt.Sprint(e.Calls), fmt.Sprint(e.InputTokens), fmt.Sprint(e.OutputTokens), costs(e)})
+	}
+	data = append(data, []string{"Total", fmt.Sprint(total.Notes), fmt.Sprint(total.Calls), fmt.Sprint(total.InputTokens), fmt.Sprint(total.OutputTokens), costs(total)})
+	pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+
+	if !priceKnown {
+		pterm.Warning.Println("No price known for this model, set --input-price and --output-price to estimate the costs.")
+		return
+	}
+	pterm.Info.Printf("Estimated costs for summarizing all files: $%.4f ($%.2f input and $%.2f output per 1M tokens)\n", total.Cost(price), price.Input, price.Output)
+	if extra := total.Calls - total.Notes; extra > 0 {
+		pterm.Info.Printf("Long notes are summarized in chunks, which takes %d additional API calls\n", extra)
+	}
+}
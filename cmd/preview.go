@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/diff"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sink"
+	"github.com/pterm/pterm"
+)
+
+const (
+	choiceAccept = "accept"
+	choiceSkip   = "skip"
+	choiceEdit   = "edit"
+)
+
+// previewer shows the changes of the notes as unified diff and, if interactive,
+// asks per note whether to write them. Notes are reviewed one at a time.
+type previewer struct {
+	interactive bool
+	// interrupt is called on Ctrl+C during a prompt to stop the run
+	interrupt func()
+
+	mu sync.Mutex
+}
+
+// review shows the diff note would write for r and returns the result with the summary
+// and tags to write, write is false if the note must not be changed
+func (p *previewer) review(note *sink.Note, r sink.Result) (sink.Result, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file := r.Path
+	for {
+		original, updated, err := note.Render(r)
+		if err != nil {
+			return r, false, err
+		}
+
+		unified := diff.Unified(original, updated, file, file+" (proposed)", 3)
+		if unified == "" {
+			pterm.Info.Printf("%s: note unchanged\n", file)
+			return r, false, nil
+		}
+		fmt.Print(colorDiff(unified))
+		if !p.interactive {
+			return r, false, nil
+		}
+
+		interrupted := false
+		choice, err := pterm.DefaultInteractiveSelect.
+			WithDefaultText(fmt.Sprintf("Write %s?", file)).
+			WithOptions([]string{choiceAccept, choiceSkip, choiceEdit}).
+			WithOnInterruptFunc(func() { interrupted = true }).
+			Show()
+		if err != nil {
+			return r, false, err
+		}
+		if interrupted {
+			p.interrupt()
+			return r, false, nil
+		}
+
+		switch choice {
+		case choiceAccept:
+			return r, true, nil
+		case choiceSkip:
+			return r, false, nil
+		case choiceEdit:
+			r.Summary, err = pterm.DefaultInteractiveTextInput.
+				WithDefaultText("Summary").
+				WithDefaultValue(r.Summary).
+				Show()
+			if err != nil {
+				return r, false, err
+			}
+			tagList, err := pterm.DefaultInteractiveTextInput.
+				WithDefaultText("Tags (comma separated)").
+				WithDefaultValue(strings.Join(r.Tags, ", ")).
+				Show()
+			if err != nil {
+				return r, false, err
+			}
+			r.Tags = nil
+			for _, tag := range strings.Split(tagList, ",") {
+				if tag = strings.TrimSpace(tag); tag != "" {
+					r.Tags = append(r.Tags, tag)
+				}
+			}
+		}
+	}
+}
+
+// colorDiff colors the added, removed and hunk header lines of a unified diff
+func colorDiff(unified string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(unified, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			b.WriteString(pterm.Bold.Sprint(line))
+		case strings.HasPrefix(line, "+"):
+			b.WriteString(pterm.FgGreen.Sprint(line))
+		case strings.HasPrefix(line, "-"):
+			b.WriteString(pterm.FgRed.Sprint(line))
+		case strings.HasPrefix(line, "@@"):
+			b.WriteString(pterm.FgCyan.Sprint(line))
+		default:
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/journal"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var (
+	revertRun  string
+	revertFile string
+)
+
+var revertCmd = &cobra.Command{
+	Use:   "revert",
+	Short: "Restore notes changed by a previous run",
+	Long: `Restore the notes exactly as they were before a run, using the journal
+every run records in .obsidian-ai-sum/journal of the vault. Notes changed since the run are
+not touched. Without --run or --file the journaled runs are listed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := journalDir(path)
+
+		switch {
+		case revertRun != "" && revertFile != "":
+			pterm.Error.Println("Use either --run or --file, not both.")
+			os.Exit(1)
+
+		case revertRun != "":
+			entries, err := journal.Load(dir, revertRun)
+			if err != nil {
+				pterm.Error.Println(err)
+				os.Exit(1)
+			}
+			reverted, refused := 0, 0
+			for _, e := range entries {
+				if err := journal.Revert(e); err != nil {
+					if errors.Is(err, journal.ErrChanged) {
+						pterm.Warning.Printf("Refusing to revert %s: changed since run %s\n", e.Path, e.Run)
+					} else {
+						pterm.Error.Printf("Error reverting %s: %v\n", e.Path, err)
+					}
+					refused++
+					continue
+				}
+				reverted++
+			}
+			pterm.Info.Printf("Reverted %d, refused %d of %d files\n", reverted, refused, len(entries))
+			if refused > 0 {
+				os.Exit(1)
+			}
+
+		case revertFile != "":
+			e, ok, err := journal.Latest(dir, revertFile)
+			if err != nil {
+				pterm.Error.Println(err)
+				os.Exit(1)
+			}
+			if !ok {
+				pterm.Error.Printf("No journaled change matches the current content of %s, it was changed since or never summarized\n", revertFile)
+				os.Exit(1)
+			}
+			if err := journal.Revert(e); err != nil {
+				pterm.Error.Printf("Error reverting %s: %v\n", revertFile, err)
+				os.Exit(1)
+			}
+			pterm.Success.Printf("Reverted %s to its state before run %s\n", revertFile, e.Run)
+
+		default:
+			runs, err := journal.Runs(dir)
+			if err != nil {
+				pterm.Error.Println(err)
+				os.Exit(1)
+			}
+			if len(runs) == 0 {
+				pterm.Info.Printf("No journaled runs in %s\n", dir)
+				return
+			}
+			for _, run := range runs {
+				entries, err := journal.Load(dir, run)
+				if err != nil {
+					pterm.Error.Println(err)
+					continue
+				}
+				pterm.Info.Printf("Run %s: %d files\n", run, len(entries))
+			}
+		}
+	},
+}
+
+func init() {
+	revertCmd.Flags().StringVar(&revertRun, "run", "", "Revert all files changed by this run")
+	revertCmd.Flags().StringVar(&revertFile, "file", "", "Revert the last journaled change of this file")
+	rootCmd.AddCommand(revertCmd)
+}
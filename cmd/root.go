@@ -1,30 +1,75 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/chunk"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/cost"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
 	"github.com/dhcgn/go-obsidian-ai-sum/internal/fswalker"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/journal"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/preprocess"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/ratelimit"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sidecar"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sink"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/state"
 	"github.com/dhcgn/go-obsidian-ai-sum/internal/summarizer"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/tags"
 	"github.com/pterm/pterm"
 	"github.com/pterm/pterm/putils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var (
-	path            string
-	apiKey          string
-	prompt          string
-	override        bool
-	debug           bool
-	dryrun          bool
-	randomFileOrder bool
-	top             int
+	cfgFile          string
+	path             string
+	provider         string
+	apiKey           string
+	baseURL          string
+	model            string
+	temperature      float64
+	topP             float64
+	maxOutputTokens  int
+	maxAttempts      int
+	retryMaxDelay    time.Duration
+	rpm              int
+	tpm              int
+	prompt           string
+	override         bool
+	debug            bool
+	dryrun           bool
+	randomFileOrder  bool
+	top              int
+	preserveModTime  bool
+	schema           frontmatter.Schema
+	mergeTags        bool
+	stale            bool
+	useState         bool
+	previewMode      bool
+	interactive      bool
+	writeFrontmatter bool
+	sidecarPath      string
+	calloutMode      bool
+	csvPath          string
+	chunkNotes       bool
+	preprocessSteps  []string
+	inputPrice       float64
+	outputPrice      float64
+	tagVocabulary    int
+	strictTags       bool
 )
 
 const (
@@ -35,40 +80,213 @@ var rootCmd = &cobra.Command{
 	Use:   "go-obsidian-ai-sum",
 	Short: "Summarize Obsidian Markdown pages using AI",
 	Run: func(cmd *cobra.Command, args []string) {
-		if apiKey == "" && !dryrun {
-			apiKey = os.Getenv("OPENAI_API_KEY")
-			if apiKey == "" {
-				pterm.Error.Println("API key is required. Provide it via --api-key flag or OPENAI_API_KEY environment variable.")
+		providerInfo, err := summarizer.Lookup(provider)
+		if err != nil {
+			pterm.Error.Println(err)
+			os.Exit(1)
+		}
+
+		if dryrun && (previewMode || interactive) {
+			pterm.Error.Println("--dryrun makes no API calls, it cannot be combined with --preview or --interactive.")
+			os.Exit(1)
+		}
+
+		if apiKey == "" && !dryrun && providerInfo.APIKeyEnv != "" {
+			apiKey = os.Getenv(providerInfo.APIKeyEnv)
+			if apiKey == "" && !providerInfo.APIKeyOptional {
+				pterm.Error.Printf("API key is required. Provide it via --api-key flag or %s environment variable.\n", providerInfo.APIKeyEnv)
 				os.Exit(1)
 			}
 		}
 
+		modifyNotes := writeFrontmatter || calloutMode
+		if !modifyNotes && sidecarPath == "" && csvPath == "" {
+			pterm.Error.Println("Nothing to write: --frontmatter=false requires --callout, --sidecar or --csv.")
+			os.Exit(1)
+		}
+		// The callout holds no metadata, without frontmatter only a sidecar or CSV tells which notes are summarized
+		if !writeFrontmatter && calloutMode && sidecarPath == "" && csvPath == "" {
+			pterm.Error.Println("--frontmatter=false --callout records no summaries to select notes by and requires --sidecar or --csv.")
+			os.Exit(1)
+		}
+		if !modifyNotes && (previewMode || interactive) {
+			pterm.Error.Println("--preview and --interactive show the changes of notes and require --frontmatter or --callout.")
+			os.Exit(1)
+		}
+
 		// Add warning banner
-		pterm.DefaultBigText.WithLetters(putils.LettersFromStringWithStyle("WARNING!", pterm.NewStyle(pterm.FgLightRed))).Render()
-		pterm.Error.Println("This tool will modify your Markdown files directly!")
-		pterm.Warning.Println("Please ensure you have backups or work with copies of your files.")
-		pterm.Warning.Println("Press Ctrl+C now if you want to abort.")
+		if modifyNotes {
+			pterm.DefaultBigText.WithLetters(putils.LettersFromStringWithStyle("WARNING!", pterm.NewStyle(pterm.FgLightRed))).Render()
+			pterm.Error.Println("This tool will modify your Markdown files directly!")
+			pterm.Warning.Println("Please ensure you have backups or work with copies of your files.")
+			pterm.Warning.Println("Changes are journaled and can be undone with the revert command.")
+			pterm.Warning.Println("Press Ctrl+C now if you want to abort.")
+		} else {
+			pterm.Info.Println("Notes are not modified, summaries are only written to the sidecar or CSV.")
+		}
 		if dryrun {
 			time.Sleep(3 * time.Second) // Give users time to read and react
 		}
 
+		if mergeTags && !cmd.Flags().Changed("tags-key") {
+			schema.TagsKey = "tags"
+		}
+		if err := schema.Validate(); err != nil {
+			pterm.Error.Printf("Invalid frontmatter keys: %v\n", err)
+			os.Exit(1)
+		}
+
+		pipeline, err := preprocess.New(preprocessSteps)
+		if err != nil {
+			pterm.Error.Println(err)
+			os.Exit(1)
+		}
+		if len(pipeline.Names()) > 0 {
+			pterm.Info.Printf("Preprocessing notes: %s\n", strings.Join(pipeline.Names(), ", "))
+		}
+
+		prompt := summarizer.LoadPrompt(prompt)
+		modelID := provider + "/" + providerInfo.Model(model)
+
+		walkOptions := fswalker.Options{Schema: schema}
+
+		// The tag index is built while walking the vault
+		var tagIndex *tags.Index
+		if tagVocabulary > 0 {
+			tagIndex = tags.NewIndex()
+			walkOptions.Index = tagIndex
+			if mergeTags {
+				walkOptions.TagsKey = schema.TagsKey
+			}
+		}
+
+		// Without frontmatter the sidecar or the CSV knows which notes are summarized
+		var sinks sink.Multi
+		var summaryOf func(rel string) (sink.Result, bool)
+		if sidecarPath != "" {
+			sidecarStore, err := sidecar.Open(sidecarPath)
+			if err != nil {
+				pterm.Error.Println(err)
+				os.Exit(1)
+			}
+			pterm.Info.Printf("Writing summaries to sidecar %s\n", sidecarPath)
+			sinks = append(sinks, sink.Sidecar(sidecarStore))
+			// A sidecar inside the vault holds no notes to summarize
+			walkOptions.Exclude = append(walkOptions.Exclude, sidecarPath)
+			if sidecar.FormatOf(sidecarPath) == sidecar.Markdown {
+				walkOptions.ExcludeSuffixes = append(walkOptions.ExcludeSuffixes, sidecar.MarkdownSuffix)
+			}
+			summaryOf = func(rel string) (sink.Result, bool) {
+				r, ok := sidecarStore.Get(rel)
+				return sink.Result{PromptHash: r.PromptHash, ContentHash: r.ContentHash, Model: r.Model}, ok
+			}
+		}
+		if csvPath != "" {
+			csvSink, err := sink.OpenCSV(csvPath)
+			if err != nil {
+				pterm.Error.Println(err)
+				os.Exit(1)
+			}
+			pterm.Info.Printf("Exporting summaries to CSV %s\n", csvPath)
+			sinks = append(sinks, csvSink)
+			walkOptions.Exclude = append(walkOptions.Exclude, csvPath)
+			if summaryOf == nil {
+				summaryOf = csvSink.Get
+			}
+		}
+		if !writeFrontmatter {
+			walkOptions.SummaryOf = func(rel string) *state.Summary {
+				r, ok := summaryOf(rel)
+				if !ok {
+					return nil
+				}
+				return &state.Summary{PromptHash: r.PromptHash, Model: r.Model, ContentHash: r.ContentHash}
+			}
+		}
+
+		// The state of a folder is cached, so unchanged notes are not read again on the next run
+		var store *state.Store
+		if info, err := os.Stat(path); err == nil && info.IsDir() && useState {
+			store = state.Open(path, fmt.Sprintf("%+v %s", schema, walkOptions.TagsKey))
+			walkOptions.State = store
+		}
+
+		// The tag vocabulary is part of the prompt and its hash, so the vault is scanned for tags first.
+		// Notes read by this scan are cached in the state and not read again for the selection.
+		var vocabulary []string
+		if tagIndex != nil {
+			indexOptions := walkOptions
+			indexOptions.Selected = func(state.Entry) bool { return false }
+			if _, err := fswalker.ReadFiles(path, indexOptions); err != nil {
+				pterm.Error.Printf("Error reading tags: %v\n", err)
+				os.Exit(1)
+			}
+			walkOptions.Index = nil
+			vocabulary = tagIndex.Top(tagVocabulary)
+			pterm.Info.Printf("Found %d distinct tags in the vault, using the %d most used as vocabulary\n", tagIndex.Len(), len(vocabulary))
+			prompt = summarizer.AddTagVocabulary(prompt, vocabulary)
+		}
+
+		hash := summarizer.ComputeHash(prompt)
+		pterm.Info.Printf("Prompt hash: %s\n", hash)
+		switch {
+		case override:
+			walkOptions.Selected = fswalker.All()
+		case stale:
+			pterm.Info.Printf("Selecting notes changed since their summary or not summarized with %s\n", modelID)
+			walkOptions.Selected = fswalker.Stale(hash, modelID)
+		}
+
+		// The notes of the vault, so the chunks of deleted notes are removed from the chunk cache
+		notes := map[string]bool{}
+		walkOptions.Visited = func(rel string) { notes[rel] = true }
+
 		start := time.Now()
-		files, err := fswalker.ReadFiles(path, override)
+		files, err := fswalker.ReadFiles(path, walkOptions)
 		pterm.Info.Printf("Reading files took: %v\n", time.Since(start))
 		if err != nil {
 			pterm.Error.Printf("Error reading files: %v\n", err)
 			os.Exit(1)
 		}
+		saveState(store)
 
 		pterm.Info.Printf("Found %d files to summarize\n", len(files))
 
-		prompt := summarizer.LoadPrompt(prompt)
-		hash := summarizer.ComputeHash(prompt)
-		pterm.Info.Printf("Prompt template hash: %s\n", hash)
-		summarizerInstance := summarizer.OpenAISummarizer{
-			APIKey: apiKey,
-			Debug:  debug,
+		options := requestOptions(cmd)
+		if tagIndex != nil && strictTags {
+			options.TagVocabulary = vocabulary
+		}
+
+		summarizerInstance, err := providerInfo.New(summarizer.Config{
+			APIKey:  apiKey,
+			BaseURL: baseURL,
+			Options: options,
+			Debug:   debug,
+		})
+		if err != nil {
+			pterm.Error.Printf("Error creating provider %s: %v\n", provider, err)
+			os.Exit(1)
 		}
+		requestsPerMinute, tokensPerMinute := rateLimits(cmd, provider)
+		if requestsPerMinute > 0 || tokensPerMinute > 0 {
+			pterm.Info.Printf("Rate limit: %d requests/min, %d tokens/min (0 = unlimited)\n", requestsPerMinute, tokensPerMinute)
+		}
+		summarizerInstance = summarizer.WithRateLimit(summarizerInstance, ratelimit.New(requestsPerMinute, tokensPerMinute))
+		retryPolicy := summarizer.DefaultRetryPolicy
+		retryPolicy.MaxAttempts = maxAttempts
+		retryPolicy.MaxDelay = retryMaxDelay
+		summarizerInstance = summarizer.WithRetry(summarizerInstance, retryPolicy)
+
+		// Summaries of the chunks of long notes are cached, so a failed note resumes with the missing chunks
+		var chunkCache *chunk.Cache
+		if chunkNotes {
+			chunkCache = chunk.OpenCache(stateRoot(path))
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				chunkCache.RetainNotes(func(note string) bool { return notes[note] })
+			}
+			summarizerInstance = summarizer.WithChunking(summarizerInstance, LimitChars, modelID, chunkCache)
+		}
+		pterm.Info.Printf("Using provider: %s\n", provider)
 
 		// Randomize file order if requested
 		if randomFileOrder {
@@ -86,21 +304,26 @@ var rootCmd = &cobra.Command{
 		}
 
 		// Cost estimation
-		// 1 token 4 characters, pricing: $0.150 / 1M tokens
-		var costs float64
-		var costsLimited float64
-		promptLength := len(prompt)
-		for _, file := range files {
-			costs += float64(file.CharacterCount+promptLength) / 4 * 0.150 / 1_000_000
-			if file.CharacterCount > LimitChars {
-				costsLimited += float64(LimitChars+promptLength) / 4 * 0.150 / 1_000_000
-			} else {
-				costsLimited += float64(file.CharacterCount+promptLength) / 4 * 0.150 / 1_000_000
-			}
+		modelName := providerInfo.Model(model)
+		price, priceKnown := cost.Lookup(provider, modelName)
+		if cmd.Flags().Changed("input-price") || cmd.Flags().Changed("output-price") {
+			price = cost.Price{Input: inputPrice, Output: outputPrice}
+			priceKnown = true
 		}
-
-		pterm.Info.Printf("Estimated costs for summarizing all files: $%.2f\n", costsLimited)
-		pterm.Info.Printf("Estimated costs if summarizing all files without truncate after limit: $%.2f\n", costs)
+		outputTokens, chunkOutput := summaryOutputTokens, chunkOutputTokens
+		if maxOutputTokens > 0 {
+			outputTokens, chunkOutput = min(outputTokens, maxOutputTokens), min(chunkOutput, maxOutputTokens)
+		}
+		plan := cost.Plan{
+			Count:             cost.ForModel(modelName),
+			Prompt:            prompt,
+			ChunkPrompt:       summarizer.ChunkPrompt,
+			Limit:             LimitChars,
+			Chunk:             chunkNotes,
+			OutputTokens:      outputTokens,
+			ChunkOutputTokens: chunkOutput,
+		}
+		printEstimate(estimateCosts(files, stateRoot(path), plan, pipeline), price, priceKnown)
 
 		// proceed?
 		if !dryrun {
@@ -121,20 +344,72 @@ var rootCmd = &cobra.Command{
 			pterm.Warning.Println("Dry run mode - no API calls will be made.")
 		}
 
+		// Every write is journaled before it happens, so the run can be reverted
+		var runJournal *journal.Journal
+		if !dryrun && modifyNotes {
+			runJournal, err = journal.Create(journalDir(path))
+			if err != nil {
+				pterm.Error.Printf("Error creating journal: %v\n", err)
+				os.Exit(1)
+			}
+			pterm.Info.Printf("Journaling changes as run %s\n", runJournal.ID())
+		}
+
+		// The note is written first, so it is never missing a summary recorded in a sidecar
+		var note *sink.Note
+		if modifyNotes {
+			note = &sink.Note{
+				PreserveModTime: preserveModTime,
+				BeforeWrite: func(file string, original, updated []byte) error {
+					return runJournal.Record(file, original, updated)
+				},
+			}
+			if writeFrontmatter {
+				note.Transforms = append(note.Transforms, sink.Frontmatter(
+					frontmatter.WithSchema(schema),
+					frontmatter.MergeTags(mergeTags),
+				))
+			}
+			if calloutMode {
+				note.Transforms = append(note.Transforms, sink.Callout())
+			}
+			sinks = append(sink.Multi{note}, sinks...)
+		}
+
+		// Stop dispatching new files on Ctrl+C or SIGTERM, files already being written are finished.
+		// A second signal terminates immediately.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			stop()
+		}()
+
 		start = time.Now()
 
 		const workerCount = 10
 		var wg sync.WaitGroup
-		jobChan := make(chan string, len(files))
+		jobChan := make(chan string)
 		errChan := make(chan error, len(files))
 
+		// Diffs and prompts of the preview replace the progress bar
+		var preview *previewer
+		progressWriter := io.Writer(os.Stdout)
+		if previewMode || interactive {
+			preview = &previewer{interactive: interactive, interrupt: stop}
+			progressWriter = io.Discard
+		}
+
 		// Create progress bar
 		progress, _ := pterm.DefaultProgressbar.
 			WithTotal(len(files)).
 			WithTitle("Summarizing files").
+			WithWriter(progressWriter).
 			Start()
 
 		var processedCount int32
+		var cancelledCount int32
+		var skippedCount int32
 
 		// Start workers
 		for i := 0; i < workerCount; i++ {
@@ -148,31 +423,98 @@ var rootCmd = &cobra.Command{
 						continue
 					}
 
-					if len(content) > LimitChars {
-						pterm.Warning.Printf("File %s with %d exceeds %d characters, truncating...\n", file, len(content), LimitChars)
-						content = content[:LimitChars]
+					// The summary callout is neither summarized nor part of the content hash
+					stripped, _ := sink.StripCallout(string(content))
+					content = []byte(stripped)
+
+					// Hashed before preprocessing and truncating, so any edit of the note makes the summary stale
+					contentHash := frontmatter.ContentHash(string(content), schema)
+
+					content = []byte(pipeline.Apply(string(content)))
+					if strings.TrimSpace(string(content)) == "" {
+						errChan <- fmt.Errorf("error summarizing file %s: no content left after preprocessing", file)
+						continue
+					}
+
+					if !chunkNotes {
+						truncated, omitted := chunk.Truncate(string(content), LimitChars)
+						if omitted.Any() {
+							pterm.Warning.Printf("File %s with %d characters exceeds %d characters, omitting %s\n", file, omitted.Total, LimitChars, omitted)
+						}
+						content = []byte(truncated)
 					}
 
 					if dryrun {
+						select {
+						case <-ctx.Done():
+							atomic.AddInt32(&cancelledCount, 1)
+							continue
+						case <-time.After(50 * time.Millisecond):
+						}
 						atomic.AddInt32(&processedCount, 1)
 						progress.UpdateTitle(fmt.Sprintf("(Dryrun) Processing %d/%d", atomic.LoadInt32(&processedCount), len(files)))
-						<-time.After(50 * time.Millisecond)
 						progress.Increment()
 						continue
 					}
 
 					progress.UpdateTitle(fmt.Sprintf("Summarizing %s", file))
-					summary, tags, err := summarizerInstance.Summarize(string(content), file, prompt, func(s string) {
+					summary, tags, err := summarizerInstance.Summarize(ctx, string(content), file, prompt, func(s string) {
 						pterm.Warning.Println(s)
 					})
 					if err != nil {
+						if ctx.Err() != nil {
+							atomic.AddInt32(&cancelledCount, 1)
+							continue
+						}
 						errChan <- fmt.Errorf("error summarizing file %s: %v", file, err)
 						continue
 					}
 
-					err = summarizer.InjectSummary(file, summary, tags, hash)
+					if tagIndex != nil {
+						tags = tagIndex.Canonicalize(tags, strictTags)
+					}
+
+					rel, _ := filepath.Rel(stateRoot(path), file)
+					result := sink.Result{
+						Path:        file,
+						RelPath:     filepath.ToSlash(rel),
+						Summary:     summary,
+						Tags:        tags,
+						PromptHash:  hash,
+						ContentHash: contentHash,
+						Model:       modelID,
+					}
+
+					if preview != nil {
+						var write bool
+						result, write, err = preview.review(note, result)
+						if err != nil {
+							errChan <- fmt.Errorf("error previewing file %s: %v", file, err)
+							continue
+						}
+						if !write {
+							atomic.AddInt32(&skippedCount, 1)
+							progress.Increment()
+							continue
+						}
+					}
+
+					// The write is not cancelled, so an interrupted run never leaves a file half-written
+					err = sinks.Write(result)
+
+					// The note is read again by the next scan, even if its modification time was preserved
+					if note != nil && store != nil {
+						if rel, err := filepath.Rel(path, file); err == nil {
+							store.Forget(rel)
+						}
+					}
 					if err != nil {
-						errChan <- fmt.Errorf("error injecting summary into file %s: %v", file, err)
+						errChan <- fmt.Errorf("error writing summary of file %s: %v", file, err)
+						continue
+					}
+					// The chunks are only needed to resume a note whose summary was not written
+					if chunkCache != nil {
+						chunkCache.Forget(chunkCache.Note(file))
 					}
 
 					atomic.AddInt32(&processedCount, 1)
@@ -182,15 +524,36 @@ var rootCmd = &cobra.Command{
 			}()
 		}
 
-		// Send jobs to workers
+		// Send jobs to workers until all are dispatched or the run is interrupted
+		dispatched := 0
+	dispatch:
 		for _, file := range files {
-			jobChan <- file.Path
+			select {
+			case <-ctx.Done():
+				break dispatch
+			case jobChan <- file.Path:
+				dispatched++
+			}
 		}
 		close(jobChan)
 
 		// Wait for all workers to complete
 		wg.Wait()
 		close(errChan)
+		saveState(store)
+		if chunkCache != nil {
+			if err := chunkCache.Save(); err != nil {
+				pterm.Warning.Printf("Failed to save chunk cache: %v\n", err)
+			}
+		}
+		if err := sinks.Close(); err != nil {
+			pterm.Error.Printf("Error writing summaries: %v\n", err)
+		}
+		if runJournal != nil {
+			if err := runJournal.Close(); err != nil {
+				pterm.Warning.Printf("Failed to close journal: %v\n", err)
+			}
+		}
 
 		progress.Stop()
 
@@ -201,10 +564,29 @@ var rootCmd = &cobra.Command{
 			errorCount++
 		}
 
-		pterm.Success.Printf("Summarization completed in %v\n", time.Since(start))
+		interrupted := ctx.Err() != nil
+		if interrupted {
+			pterm.Warning.Printf("Interrupted after %v\n", time.Since(start))
+		} else {
+			pterm.Success.Printf("Summarization completed in %v\n", time.Since(start))
+		}
 		if errorCount > 0 {
 			pterm.Warning.Printf("Encountered %d errors during processing\n", errorCount)
 		}
+		if preview != nil {
+			pterm.Info.Printf("Previewed %d files, wrote %d, skipped %d\n",
+				atomic.LoadInt32(&processedCount)+atomic.LoadInt32(&skippedCount), atomic.LoadInt32(&processedCount), atomic.LoadInt32(&skippedCount))
+		}
+		if runJournal != nil && runJournal.Len() > 0 {
+			pterm.Info.Printf("Undo the %d changes of this run with: go-obsidian-ai-sum revert --path %s --run %s\n", runJournal.Len(), path, runJournal.ID())
+		}
+		if interrupted {
+			notProcessed := len(files) - dispatched + int(atomic.LoadInt32(&cancelledCount))
+			pterm.Info.Printf("Processed %d, failed %d, not processed %d of %d files\n",
+				atomic.LoadInt32(&processedCount), errorCount, notProcessed, len(files))
+			pterm.Info.Println("Run the same command again to continue, already summarized files are skipped.")
+			os.Exit(130)
+		}
 	},
 }
 
@@ -218,18 +600,148 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Config file (default is .go-obsidian-ai-sum.yaml in the current or home directory)")
 	rootCmd.PersistentFlags().StringVar(&path, "path", "", "Path to file or folder")
+	rootCmd.PersistentFlags().StringVar(&provider, "provider", summarizer.DefaultProvider, fmt.Sprintf("AI provider to use (%s)", strings.Join(summarizer.Providers(), ", ")))
 	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", "", "API key for the AI provider")
+	rootCmd.PersistentFlags().StringVar(&baseURL, "base-url", "", "Base URL of the AI provider API (e.g. http://localhost:8000/v1)")
+	rootCmd.PersistentFlags().StringVar(&model, "model", "", "Model to use (default depends on the provider)")
+	rootCmd.PersistentFlags().Float64Var(&temperature, "temperature", 0, "Sampling temperature, e.g. 0 for reproducible runs (default depends on the provider)")
+	rootCmd.PersistentFlags().Float64Var(&topP, "top-p", 0, "Nucleus sampling probability (default depends on the provider)")
+	rootCmd.PersistentFlags().IntVar(&maxOutputTokens, "max-output-tokens", 0, "Maximum number of output tokens (default depends on the provider)")
+	rootCmd.PersistentFlags().Float64Var(&inputPrice, "input-price", 0, "Price of input tokens in USD per 1M tokens for the cost estimate (default from the pricing table of the model)")
+	rootCmd.PersistentFlags().Float64Var(&outputPrice, "output-price", 0, "Price of output tokens in USD per 1M tokens for the cost estimate (default from the pricing table of the model)")
+	rootCmd.PersistentFlags().IntVar(&maxAttempts, "max-attempts", summarizer.DefaultRetryPolicy.MaxAttempts, "Maximum number of attempts per file for rate limited or failed API calls")
+	rootCmd.PersistentFlags().DurationVar(&retryMaxDelay, "retry-max-delay", summarizer.DefaultRetryPolicy.MaxDelay, "Maximum delay between two attempts")
+	rootCmd.PersistentFlags().IntVar(&rpm, "rpm", 0, "Maximum requests per minute shared by all workers (0 for unlimited)")
+	rootCmd.PersistentFlags().IntVar(&tpm, "tpm", 0, "Maximum estimated tokens per minute shared by all workers (0 for unlimited)")
 	rootCmd.PersistentFlags().StringVar(&prompt, "prompt", "", "Custom prompt for summarization")
 	rootCmd.PersistentFlags().BoolVar(&override, "override", false, "Override existing summaries")
+	rootCmd.PersistentFlags().BoolVar(&stale, "stale", false, "Summarize notes without summary and notes whose content, prompt or model changed since their summary")
+	rootCmd.PersistentFlags().BoolVar(&useState, "state", true, "Cache the scan results of a folder in "+state.Dir+"/"+state.FileName+", so unchanged notes are not read again")
 	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enable debug mode to log payloads")
 	rootCmd.PersistentFlags().BoolVar(&dryrun, "dryrun", false, "Dry run mode - stops before making API calls")
+	rootCmd.PersistentFlags().BoolVar(&previewMode, "preview", false, "Call the model and show the frontmatter changes as diff without writing them")
+	rootCmd.PersistentFlags().BoolVar(&interactive, "interactive", false, "Preview every note and ask whether to accept, skip or edit its summary")
+	rootCmd.PersistentFlags().StringSliceVar(&preprocessSteps, "preprocess", preprocess.DefaultSteps, fmt.Sprintf("Steps removing noise from notes before they are sent to the model (%s), none to send notes as they are", strings.Join(preprocess.Names(), ", ")))
+	rootCmd.PersistentFlags().BoolVar(&chunkNotes, "chunk", true, fmt.Sprintf("Summarize notes over %d characters in chunks and then the summaries of the chunks, false truncates them instead", LimitChars))
 	rootCmd.PersistentFlags().BoolVar(&randomFileOrder, "random-file-access", false, "Process files in random order")
 	rootCmd.PersistentFlags().IntVar(&top, "top", 0, "Process only this many files (0 for all)")
+	rootCmd.PersistentFlags().StringVar(&schema.SummaryKey, "summary-key", frontmatter.DefaultSchema.SummaryKey, "Frontmatter key of the summary, nested keys are separated by dots (e.g. ai.summary)")
+	rootCmd.PersistentFlags().StringVar(&schema.HashKey, "hash-key", frontmatter.DefaultSchema.HashKey, "Frontmatter key of the prompt hash")
+	rootCmd.PersistentFlags().StringVar(&schema.TagsKey, "tags-key", frontmatter.DefaultSchema.TagsKey, "Frontmatter key of the tags, \"tags\" for Obsidian's native tags, empty to not write tags")
+	rootCmd.PersistentFlags().StringVar(&schema.AddedTagsKey, "added-tags-key", frontmatter.DefaultSchema.AddedTagsKey, "Frontmatter key recording the tags added by --merge-tags")
+	rootCmd.PersistentFlags().StringVar(&schema.ContentHashKey, "content-hash-key", frontmatter.DefaultSchema.ContentHashKey, "Frontmatter key of the hash of the summarized content, empty to not record it")
+	rootCmd.PersistentFlags().StringVar(&schema.ModelKey, "model-key", frontmatter.DefaultSchema.ModelKey, "Frontmatter key of the model which created the summary, empty to not record it")
+	rootCmd.PersistentFlags().BoolVar(&mergeTags, "merge-tags", false, "Merge normalized tags into the existing tags instead of replacing them (uses Obsidian's native tags unless --tags-key is set)")
+	rootCmd.PersistentFlags().IntVar(&tagVocabulary, "tag-vocabulary", 0, "Suggest the N most used tags of the vault to the model and map near-duplicate tags to them (0 to disable)")
+	rootCmd.PersistentFlags().BoolVar(&strictTags, "tag-vocabulary-strict", false, "Only allow tags already used in the vault, restricting the model to the vocabulary of --tag-vocabulary")
+	rootCmd.PersistentFlags().BoolVar(&writeFrontmatter, "frontmatter", true, "Write summaries into the frontmatter of the notes")
+	rootCmd.PersistentFlags().BoolVar(&calloutMode, "callout", false, "Write summaries as > [!summary] callout at the top of the note body")
+	rootCmd.PersistentFlags().StringVar(&sidecarPath, "sidecar", "", "Also write summaries to a sidecar: a .json or .jsonl file, or a directory of <note>.summary.md files")
+	rootCmd.PersistentFlags().StringVar(&csvPath, "csv", "", "Also export summaries to a CSV file with a row per note")
+	rootCmd.PersistentFlags().BoolVar(&preserveModTime, "preserve-mtime", false, "Keep the modification time of summarized files")
 
 	rootCmd.MarkPersistentFlagRequired("path")
 }
 
 func initConfig() {
+	if cfgFile != "" {
+		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.AddConfigPath(".")
+		if home, err := os.UserHomeDir(); err == nil {
+			viper.AddConfigPath(home)
+		}
+		viper.SetConfigName(".go-obsidian-ai-sum")
+	}
+
+	viper.SetEnvPrefix("OBSIDIAN_AI_SUM")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv()
+
+	if err := viper.ReadInConfig(); err != nil {
+		if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound || cfgFile != "" {
+			pterm.Error.Printf("Error reading config file: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		pterm.Info.Printf("Using config file: %s\n", viper.ConfigFileUsed())
+	}
+
+	applyConfig(rootCmd.PersistentFlags())
+}
+
+// applyConfig sets every flag that was not given on the command line
+// from the config file or an OBSIDIAN_AI_SUM_* environment variable
+func applyConfig(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if f.Changed || f.Name == "config" || !viper.IsSet(f.Name) {
+			return
+		}
+		value := viper.GetString(f.Name)
+		if strings.HasSuffix(f.Value.Type(), "Slice") {
+			value = strings.Join(viper.GetStringSlice(f.Name), ",")
+		}
+		if err := flags.Set(f.Name, value); err != nil {
+			pterm.Error.Printf("Invalid value for %s in config: %v\n", f.Name, err)
+			os.Exit(1)
+		}
+	})
+}
+
+// rateLimits returns the requests and tokens per minute budget. Flags take precedence
+// over the provider specific values under rate-limits.<provider> in the config file.
+func rateLimits(cmd *cobra.Command, provider string) (int, int) {
+	requestsPerMinute, tokensPerMinute := rpm, tpm
+	if !cmd.Flags().Changed("rpm") {
+		if key := "rate-limits." + provider + ".rpm"; viper.IsSet(key) {
+			requestsPerMinute = viper.GetInt(key)
+		}
+	}
+	if !cmd.Flags().Changed("tpm") {
+		if key := "rate-limits." + provider + ".tpm"; viper.IsSet(key) {
+			tokensPerMinute = viper.GetInt(key)
+		}
+	}
+	return requestsPerMinute, tokensPerMinute
+}
+
+// requestOptions builds the model parameters from the flags,
+// leaving values unset that were not given so the provider defaults apply
+func requestOptions(cmd *cobra.Command) summarizer.RequestOptions {
+	options := summarizer.RequestOptions{
+		Model:           model,
+		MaxOutputTokens: maxOutputTokens,
+	}
+	if cmd.Flags().Changed("temperature") {
+		options.Temperature = summarizer.Float(temperature)
+	}
+	if cmd.Flags().Changed("top-p") {
+		options.TopP = summarizer.Float(topP)
+	}
+	return options
+}
+
+// stateRoot returns the folder holding the state directory: path itself or the folder of a single file
+func stateRoot(path string) string {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return filepath.Dir(path)
+	}
+	return path
+}
+
+// journalDir returns the directory of the run journals for path
+func journalDir(path string) string {
+	return filepath.Join(stateRoot(path), state.Dir, "journal")
+}
+
+// saveState writes the state store if there is one, failing to do so only costs time on the next run
+func saveState(store *state.Store) {
+	if store == nil {
+		return
+	}
+	if err := store.Save(); err != nil {
+		pterm.Warning.Printf("Failed to save state: %v\n", err)
+	}
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fswalker"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/journal"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sink"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var stripCmd = &cobra.Command{
+	Use:   "strip",
+	Short: "Remove the summary callouts written by --callout",
+	Long: `Remove the summary callout and its markers from the body of every note, leaving the rest
+of the note untouched. The changes are journaled and can be undone with the revert command.
+With --dryrun the notes with a callout are only listed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		files, err := fswalker.ReadFiles(path, fswalker.Options{Schema: schema, Selected: fswalker.All()})
+		if err != nil {
+			pterm.Error.Printf("Error reading files: %v\n", err)
+			os.Exit(1)
+		}
+
+		var runJournal *journal.Journal
+		stripped, failed := 0, 0
+		for _, file := range files {
+			content, err := os.ReadFile(file.Path)
+			if err != nil {
+				pterm.Error.Printf("Error reading file %s: %v\n", file.Path, err)
+				failed++
+				continue
+			}
+			updated, removed := sink.StripCallout(string(content))
+			if !removed {
+				continue
+			}
+			if dryrun {
+				pterm.Info.Printf("Would strip %s\n", file.Path)
+				stripped++
+				continue
+			}
+
+			if runJournal == nil {
+				if runJournal, err = journal.Create(journalDir(path)); err != nil {
+					pterm.Error.Printf("Error creating journal: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			if err := runJournal.Record(file.Path, content, []byte(updated)); err != nil {
+				pterm.Error.Printf("Error journaling %s: %v\n", file.Path, err)
+				failed++
+				continue
+			}
+			if err := fsutil.WriteFileAtomic(file.Path, []byte(updated), preserveModTime); err != nil {
+				pterm.Error.Printf("Error writing %s: %v\n", file.Path, err)
+				failed++
+				continue
+			}
+			stripped++
+		}
+
+		if runJournal != nil {
+			if err := runJournal.Close(); err != nil {
+				pterm.Warning.Printf("Failed to close journal: %v\n", err)
+			}
+		}
+
+		pterm.Info.Printf("Stripped %d, failed %d of %d files\n", stripped, failed, len(files))
+		if runJournal != nil && runJournal.Len() > 0 {
+			pterm.Info.Printf("Undo with: go-obsidian-ai-sum revert --path %s --run %s\n", path, runJournal.ID())
+		}
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(stripCmd)
+}
@@ -0,0 +1,170 @@
+package chunk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/state"
+)
+
+const (
+	// CacheFileName is the name of the chunk cache within state.Dir
+	CacheFileName = "chunks.json"
+	// ReduceSuffix is appended to the note for the chunks of a reduction of its chunk summaries
+	ReduceSuffix = "#reduce"
+
+	cacheVersion = 1
+)
+
+// Result is the summary of a chunk
+type Result struct {
+	Summary string   `json:"summary"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type cacheFile struct {
+	Version int                          `json:"version"`
+	Notes   map[string]map[string]Result `json:"notes"`
+}
+
+// Cache keeps the summaries of the chunks of long notes by note and chunk key, so a note
+// whose summary failed resumes with the missing chunks. It is safe for concurrent use.
+type Cache struct {
+	root string
+	path string
+
+	mu      sync.Mutex
+	notes   map[string]map[string]Result
+	changed bool
+}
+
+// OpenCache loads the chunk cache of the vault at root, a missing or unreadable cache results in an empty one
+func OpenCache(root string) *Cache {
+	c := &Cache{root: root, path: filepath.Join(root, state.Dir, CacheFileName), notes: map[string]map[string]Result{}}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c
+	}
+	var f cacheFile
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != cacheVersion {
+		return c
+	}
+	if f.Notes != nil {
+		c.notes = f.Notes
+	}
+	return c
+}
+
+// Note returns the cache key of the note at path: the slash separated path relative to the vault,
+// so the cache is hit whether the vault was given as "." or as absolute path
+func (c *Cache) Note(path string) string {
+	root, err := filepath.Abs(c.root)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Get returns the cached result of a chunk of note
+func (c *Cache) Get(note, key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.notes[note][key]
+	return r, ok
+}
+
+// Put caches the result of a chunk of note
+func (c *Cache) Put(note, key string, r Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.notes[note] == nil {
+		c.notes[note] = map[string]Result{}
+	}
+	c.notes[note][key] = r
+	c.changed = true
+}
+
+// Retain removes all chunks of note except the ones with the given keys, e.g. of edited parts
+func (c *Cache) Retain(note string, keys []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[key] = true
+	}
+	for key := range c.notes[note] {
+		if !keep[key] {
+			delete(c.notes[note], key)
+			c.changed = true
+		}
+	}
+	if len(c.notes[note]) == 0 {
+		delete(c.notes, note)
+	}
+}
+
+// Forget removes all chunks of note and of its reductions, e.g. once its summary is written
+func (c *Cache) Forget(note string) {
+	c.RetainNotes(func(other string) bool { return other != note })
+}
+
+// RetainNotes removes the chunks of all notes for which keep returns false, e.g. of deleted notes.
+// keep is called with the note, the reductions of a note belong to it.
+func (c *Cache) RetainNotes(keep func(note string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.notes {
+		note := key
+		for strings.HasSuffix(note, ReduceSuffix) {
+			note = strings.TrimSuffix(note, ReduceSuffix)
+		}
+		if !keep(note) {
+			delete(c.notes, key)
+			c.changed = true
+		}
+	}
+}
+
+// Len returns the number of cached chunks
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, chunks := range c.notes {
+		n += len(chunks)
+	}
+	return n
+}
+
+// Save writes the cache atomically if it changed, creating its directory if needed
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	if !c.changed {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Notes: c.notes})
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode chunk cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return fsutil.WriteFileAtomic(c.path, data, false)
+}
@@ -0,0 +1,122 @@
+package chunk
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fence"
+)
+
+var headingRegex = regexp.MustCompile(`^#{1,6}(\s|$)`)
+
+// splitters split a text into consecutive parts, from the coarsest to the finest
+var splitters = []func(text string) []string{sections, paragraphs, lines}
+
+// Split splits Markdown text into chunks of at most limit runes which concatenated give text.
+// Chunks end before headings where possible, else after paragraphs, then lines. Only a single
+// line longer than limit is cut within. Code fences are never split at their headings or blank lines.
+func Split(text string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	return split(text, limit, 0)
+}
+
+func split(text string, limit, level int) []string {
+	if utf8.RuneCountInString(text) <= limit {
+		return []string{text}
+	}
+	if level == len(splitters) {
+		return cut(text, limit)
+	}
+
+	// Small parts are packed together, so chunks are as large as possible
+	var chunks []string
+	current, currentLen := "", 0
+	for _, part := range splitters[level](text) {
+		partLen := utf8.RuneCountInString(part)
+		if partLen > limit {
+			if current != "" {
+				chunks = append(chunks, current)
+				current, currentLen = "", 0
+			}
+			chunks = append(chunks, split(part, limit, level+1)...)
+			continue
+		}
+		if currentLen+partLen > limit {
+			chunks = append(chunks, current)
+			current, currentLen = "", 0
+		}
+		current += part
+		currentLen += partLen
+	}
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+	return chunks
+}
+
+// sections splits text before every heading
+func sections(text string) []string {
+	return splitBefore(text, func(line, previous string) bool {
+		return headingRegex.MatchString(line)
+	})
+}
+
+// paragraphs splits text before every line following a blank line
+func paragraphs(text string) []string {
+	return splitBefore(text, func(line, previous string) bool {
+		return strings.TrimSpace(previous) == "" && strings.TrimSpace(line) != ""
+	})
+}
+
+// lines splits text after every line ending
+func lines(text string) []string {
+	parts := strings.SplitAfter(text, "\n")
+	if parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// splitBefore splits text before every line outside of code fences for which boundary
+// returns true. previous is the line before, empty for the first line.
+func splitBefore(text string, boundary func(line, previous string) bool) []string {
+	var parts []string
+	start, previous := 0, ""
+	var fences fence.Scanner
+	for offset := 0; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset + 1
+		}
+		line := strings.TrimRight(text[offset:end], "\r\n")
+
+		if fences.Fence() == "" && offset > start && boundary(line, previous) {
+			parts = append(parts, text[start:offset])
+			start = offset
+		}
+		fences.Next(line)
+
+		previous = line
+		offset = end
+	}
+	return append(parts, text[start:])
+}
+
+// cut splits text into parts of at most limit runes
+func cut(text string, limit int) []string {
+	var parts []string
+	start, runes := 0, 0
+	for i := range text {
+		if runes == limit {
+			parts = append(parts, text[start:i])
+			start, runes = i, 0
+		}
+		runes++
+	}
+	return append(parts, text[start:])
+}
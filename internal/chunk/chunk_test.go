@@ -0,0 +1,120 @@
+package chunk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/state"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		expected []string
+	}{
+		{"Fits", "# A\ntext\n", 100, []string{"# A\ntext\n"}},
+		{"Headings", "# A\naaaa\n# B\nbbbb\n", 12, []string{"# A\naaaa\n", "# B\nbbbb\n"}},
+		{"Packs small sections", "# A\na\n# B\nb\n# C\ncccccccc\n", 13, []string{"# A\na\n# B\nb\n", "# C\ncccccccc\n"}},
+		{"Paragraphs", "# A\naaaa\n\nbbbb\n\ncccc\n", 12, []string{"# A\naaaa\n\n", "bbbb\n\ncccc\n"}},
+		{"Lines", "aaaa\nbbbb\ncccc\n", 10, []string{"aaaa\nbbbb\n", "cccc\n"}},
+		{"Long line", "aaaaaaaaaa", 4, []string{"aaaa", "aaaa", "aa"}},
+		{"Runes", "äääää", 3, []string{"äää", "ää"}},
+		{"Heading in code fence", "# A\n```\n# not a heading\n```\n# B\nb\n", 30, []string{"# A\n```\n# not a heading\n```\n", "# B\nb\n"}},
+		{"Blank line in code fence", "x\n\n```\na\n\nb\n```\n", 14, []string{"x\n\n", "```\na\n\nb\n```\n"}},
+		{"Shorter fence inside code fence", "# A\n````\n```\n# not a heading\n````\n# B\n", 36, []string{"# A\n````\n```\n# not a heading\n````\n", "# B\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.text, tt.limit)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if joined := strings.Join(got, ""); joined != tt.text {
+				t.Errorf("chunks do not add up to the text: %q", joined)
+			}
+			for _, chunk := range got {
+				if utf8.RuneCountInString(chunk) > tt.limit || !utf8.ValidString(chunk) {
+					t.Errorf("invalid chunk %q", chunk)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheNote(t *testing.T) {
+	vault := t.TempDir()
+	t.Chdir(vault)
+	c := OpenCache(".")
+	abs := OpenCache(vault)
+	for _, path := range []string{"notes/a.md", filepath.Join(vault, "notes", "a.md"), "./notes/a.md"} {
+		if got := c.Note(path); got != "notes/a.md" {
+			t.Errorf("Note(%q) = %q with relative root, expected notes/a.md", path, got)
+		}
+		if got := abs.Note(path); got != "notes/a.md" {
+			t.Errorf("Note(%q) = %q with absolute root, expected notes/a.md", path, got)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	root := t.TempDir()
+	c := OpenCache(root)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, state.Dir)); !os.IsNotExist(err) {
+		t.Errorf("expected an unchanged cache not to be written, got %v", err)
+	}
+	c.Put("a.md", "1", Result{Summary: "one"})
+	c.Put("a.md", "2", Result{Summary: "two", Tags: []string{"t"}})
+	c.Put("b.md", "1", Result{Summary: "other"})
+	c.Retain("a.md", []string{"2"})
+	c.Retain("c.md", nil)
+	if err := c.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := OpenCache(root)
+	if loaded.Len() != 2 {
+		t.Errorf("expected 2 chunks, got %d", loaded.Len())
+	}
+	if _, ok := loaded.Get("a.md", "1"); ok {
+		t.Error("expected chunk 1 of a.md to be removed")
+	}
+	if r, ok := loaded.Get("a.md", "2"); !ok || !reflect.DeepEqual(r, Result{Summary: "two", Tags: []string{"t"}}) {
+		t.Errorf("unexpected chunk 2 of a.md: %+v (found %v)", r, ok)
+	}
+	if r, ok := loaded.Get("b.md", "1"); !ok || r.Summary != "other" {
+		t.Errorf("unexpected chunk of b.md: %+v (found %v)", r, ok)
+	}
+}
+
+func TestCacheForget(t *testing.T) {
+	c := OpenCache(t.TempDir())
+	for _, note := range []string{"a.md", "a.md" + ReduceSuffix, "a.md" + ReduceSuffix + ReduceSuffix, "ab.md", "b.md", "deleted.md" + ReduceSuffix} {
+		c.Put(note, "1", Result{Summary: note})
+	}
+	c.Forget("a.md")
+	if c.Len() != 3 {
+		t.Errorf("expected 3 chunks after Forget, got %d", c.Len())
+	}
+	if _, ok := c.Get("a.md"+ReduceSuffix, "1"); ok {
+		t.Error("expected the reduction of a.md to be removed")
+	}
+
+	c.RetainNotes(func(note string) bool { return note != "deleted.md" })
+	if c.Len() != 2 {
+		t.Errorf("expected 2 chunks after RetainNotes, got %d", c.Len())
+	}
+	for _, note := range []string{"ab.md", "b.md"} {
+		if _, ok := c.Get(note, "1"); !ok {
+			t.Errorf("expected the chunk of %s to be kept", note)
+		}
+	}
+}
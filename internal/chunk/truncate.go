@@ -0,0 +1,164 @@
+package chunk
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fence"
+)
+
+var (
+	dataURIRegex = regexp.MustCompile(`data:[\w.+-]+/[\w.+-]+;base64,[A-Za-z0-9+/]+=*`)
+	base64Regex  = regexp.MustCompile(`[A-Za-z0-9+/]{200,}={0,2}`)
+)
+
+const (
+	embeddedPlaceholder = "[base64 data omitted]"
+
+	// noteReserve are the runes kept free for the note appended to a truncated text
+	noteReserve = 200
+)
+
+// Omitted describes what Truncate removed from a text
+type Omitted struct {
+	// Embedded is the number of removed base64 data, e.g. pasted images
+	Embedded int
+	// CodeBlocks is the number of code blocks whose content was removed
+	CodeBlocks int
+	// Runes is the number of runes cut from the end
+	Runes int
+	// Total is the number of runes of the original text
+	Total int
+}
+
+// Any reports whether anything was omitted
+func (o Omitted) Any() bool {
+	return o.Embedded > 0 || o.CodeBlocks > 0 || o.Runes > 0
+}
+
+// String describes what was omitted, e.g. "2 code blocks and the last 1200 of 60000 characters"
+func (o Omitted) String() string {
+	var parts []string
+	if o.Embedded > 0 {
+		parts = append(parts, fmt.Sprintf("%d embedded base64 data", o.Embedded))
+	}
+	if o.CodeBlocks > 0 {
+		parts = append(parts, fmt.Sprintf("%d code blocks", o.CodeBlocks))
+	}
+	if o.Runes > 0 {
+		parts = append(parts, fmt.Sprintf("the last %d of %d characters", o.Runes, o.Total))
+	}
+	if len(parts) <= 1 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// Truncate shortens Markdown text to at most limit runes. Embedded base64 data is removed
+// first, then the content of code blocks from the largest one, and only then the end of the
+// text is cut before a heading, else a paragraph or a line. A truncated text ends with a
+// note telling the model what was omitted. Texts within the limit are returned as they are.
+func Truncate(text string, limit int) (string, Omitted) {
+	o := Omitted{Total: utf8.RuneCountInString(text)}
+	if limit <= 0 || o.Total <= limit {
+		return text, o
+	}
+
+	text = dataURIRegex.ReplaceAllStringFunc(text, func(string) string {
+		o.Embedded++
+		return embeddedPlaceholder
+	})
+	text = base64Regex.ReplaceAllStringFunc(text, func(string) string {
+		o.Embedded++
+		return embeddedPlaceholder
+	})
+
+	limit = max(limit-noteReserve, 1)
+	text, o.CodeBlocks = condenseCodeBlocks(text, limit)
+
+	if length := utf8.RuneCountInString(text); length > limit {
+		prefix, prefixLen := "", 0
+		for _, chunk := range Split(text, limit) {
+			chunkLen := utf8.RuneCountInString(chunk)
+			if prefixLen+chunkLen > limit {
+				break
+			}
+			prefix += chunk
+			prefixLen += chunkLen
+		}
+		o.Runes = length - prefixLen
+		text = prefix
+	}
+
+	if !o.Any() {
+		return text, o
+	}
+	if marker := openFence(text); marker != "" {
+		text = strings.TrimRight(text, "\r\n") + "\n" + marker + "\n"
+	}
+	return strings.TrimRight(text, "\r\n") + "\n\n[The note was truncated to fit the limit, omitted were " + o.String() + ".]\n", o
+}
+
+// codeBlock is the byte range of the lines between the fences of a code block
+type codeBlock struct {
+	start, end int
+}
+
+// codeBlocks returns the content of all fenced code blocks of text, the content of an
+// unclosed one reaches to the end of text. marker is the fence of an unclosed block.
+func codeBlocks(text string) (blocks []codeBlock, marker string) {
+	for _, b := range fence.Blocks(text) {
+		blocks = append(blocks, codeBlock{b.ContentStart, b.ContentEnd})
+		if !b.Closed {
+			marker = b.Fence
+		}
+	}
+	return blocks, marker
+}
+
+// openFence returns the fence of a code block left open at the end of text
+func openFence(text string) string {
+	_, marker := codeBlocks(text)
+	return marker
+}
+
+// condenseCodeBlocks replaces the content of code blocks, the largest first,
+// until text fits into limit runes and returns the number of condensed blocks
+func condenseCodeBlocks(text string, limit int) (string, int) {
+	blocks, _ := codeBlocks(text)
+	sort.SliceStable(blocks, func(i, j int) bool {
+		return blocks[i].end-blocks[i].start > blocks[j].end-blocks[j].start
+	})
+
+	length := utf8.RuneCountInString(text)
+	var condensed []codeBlock
+	replacement := map[codeBlock]string{}
+	for _, b := range blocks {
+		if length <= limit {
+			break
+		}
+		content := text[b.start:b.end]
+		lines := strings.Count(content, "\n")
+		if !strings.HasSuffix(content, "\n") {
+			lines++
+		}
+		r := fmt.Sprintf("[%d lines of code omitted]\n", lines)
+		saved := utf8.RuneCountInString(content) - utf8.RuneCountInString(r)
+		if saved <= 0 {
+			continue
+		}
+		length -= saved
+		condensed = append(condensed, b)
+		replacement[b] = r
+	}
+
+	// Replaced from the end, so the offsets of the other blocks stay valid
+	sort.Slice(condensed, func(i, j int) bool { return condensed[i].start > condensed[j].start })
+	for _, b := range condensed {
+		text = text[:b.start] + replacement[b] + text[b.end:]
+	}
+	return text, len(condensed)
+}
@@ -0,0 +1,93 @@
+package chunk
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	long := func(s string, n int) string { return strings.Repeat(s, n) }
+	image := "![img](data:image/png;base64," + long("iVBORw0KGgo", 100) + "==)\n"
+	code := "```go\n" + long("fmt.Println(\"x\")\n", 100) + "```\n"
+
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		expected Omitted
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "Within limit",
+			text:     "# A\n" + image + code,
+			limit:    10_000,
+			expected: Omitted{Total: utf8.RuneCountInString("# A\n" + image + code)},
+			contains: []string{"iVBORw0KGgo", "fmt.Println"},
+		},
+		{
+			name:     "Embedded data first",
+			text:     "# A\ntext\n" + image + code,
+			limit:    2_500,
+			contains: []string{"[base64 data omitted]", "fmt.Println", "omitted were 1 embedded base64 data."},
+			excludes: []string{"iVBORw0KGgo"},
+		},
+		{
+			name:     "Code blocks next",
+			text:     "# A\ntext\n" + code + "# B\nend\n",
+			limit:    500,
+			contains: []string{"```go\n[100 lines of code omitted]\n```\n# B\nend\n", "omitted were 1 code blocks."},
+		},
+		{
+			name:     "Cut at heading",
+			text:     "# A\n" + long("ä", 250) + "\n# B\n" + long("ö", 250) + "\n",
+			limit:    500,
+			contains: []string{"# A\n", "omitted were the last 255 of 510 characters."},
+			excludes: []string{"# B", "ö"},
+		},
+		{
+			name:     "Closes cut code fence",
+			text:     "```\n" + long("日本語のテキスト\n", 100),
+			limit:    400,
+			contains: []string{"```\n[100 lines of code omitted]\n```\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, omitted := Truncate(tt.text, tt.limit)
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) > tt.limit {
+				t.Errorf("invalid result with %d runes: %q", utf8.RuneCountInString(got), got)
+			}
+			if tt.expected != (Omitted{}) && omitted != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, omitted)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(got, s) {
+					t.Errorf("expected %q in %q", s, got)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(got, s) {
+					t.Errorf("expected no %q in %q", s, got)
+				}
+			}
+		})
+	}
+}
+
+func TestOmittedString(t *testing.T) {
+	tests := []struct {
+		omitted  Omitted
+		expected string
+	}{
+		{Omitted{}, ""},
+		{Omitted{CodeBlocks: 2}, "2 code blocks"},
+		{Omitted{Embedded: 1, CodeBlocks: 2, Runes: 3, Total: 9}, "1 embedded base64 data, 2 code blocks and the last 3 of 9 characters"},
+	}
+	for _, tt := range tests {
+		if got := tt.omitted.String(); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
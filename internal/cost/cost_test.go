@@ -0,0 +1,114 @@
+package cost
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	// The heuristic is compared with OpenAI's cl100k encoding, it is only meant to be roughly right
+	cl100k := ForModel("gpt-4")
+	texts := map[string]string{
+		"empty":   "",
+		"words":   "the quick brown fox jumps over the lazy dog.",
+		"numbers": "12345",
+		"prose":   strings.Repeat("Obsidian stores notes as plain Markdown files, so they can be summarized by any tool. ", 50),
+		"german":  strings.Repeat("Die Zusammenfassung der Notizen wird in die Metadaten der Markdown-Dateien geschrieben. ", 20),
+		"code":    strings.Repeat("func main() {\n\tfmt.Println(\"hello\", x[i])\n\treturn nil\n}\n", 20),
+	}
+	for name, text := range texts {
+		got, expected := float64(Count(text)), float64(cl100k(text))
+		if math.Abs(got-expected) > 0.25*expected {
+			t.Errorf("%s: Count = %v, cl100k counts %v", name, got, expected)
+		}
+	}
+}
+
+func TestForModel(t *testing.T) {
+	text := strings.TrimSpace(strings.Repeat("word ", 100))
+	tests := map[string]int{
+		"gpt-4o-mini":             100,
+		"gpt-3.5-turbo":           100,
+		"claude-3-5-haiku-latest": 120,
+		"mistral":                 110,
+	}
+	for model, expected := range tests {
+		if got := ForModel(model)(text); got != expected {
+			t.Errorf("ForModel(%q) counted %d, expected %d", model, got, expected)
+		}
+	}
+
+	// OpenAI models are counted with their encoding, o200k needs fewer tokens for Japanese
+	for model, expected := range map[string]int{"gpt-4": 8, "gpt-4o": 6, "o3-mini": 6} {
+		if got := ForModel(model)("日本語のテキスト"); got != expected {
+			t.Errorf("ForModel(%q) counted %d, expected %d", model, got, expected)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		expected        Price
+		found           bool
+	}{
+		{"openai", "gpt-4o-mini", Price{0.15, 0.60}, true},
+		{"openai", "gpt-4o-mini-2024-07-18", Price{0.15, 0.60}, true},
+		{"openai", "gpt-4o", Price{2.50, 10.00}, true},
+		{"anthropic", "claude-3-5-haiku-latest", Price{0.80, 4.00}, true},
+		{"anthropic", "claude-3-5-haiku-20241022", Price{0.80, 4.00}, true},
+		{"anthropic", "claude-sonnet-4-20250514", Price{3.00, 15.00}, true},
+		{"openai", "o3-pro", Price{}, false},
+		{"openai", "gpt-4o-mini-audio-preview", Price{}, false},
+		{"openai", "gpt-4o-mini-2024-07", Price{}, false},
+		{"ollama", "llama3.2", Price{}, true},
+		{"openai-chat", "qwen2.5", Price{}, false},
+	}
+	for _, tt := range tests {
+		price, found := Lookup(tt.provider, tt.model)
+		if price != tt.expected || found != tt.found {
+			t.Errorf("Lookup(%q, %q) = %v, %v, expected %v, %v", tt.provider, tt.model, price, found, tt.expected, tt.found)
+		}
+	}
+}
+
+func TestPlanNote(t *testing.T) {
+	words := func(n int) string { return strings.TrimSpace(strings.Repeat("word ", n)) }
+	plan := Plan{
+		Count:             Count,
+		Prompt:            words(10),
+		ChunkPrompt:       words(5),
+		Limit:             500,
+		Chunk:             true,
+		OutputTokens:      20,
+		ChunkOutputTokens: 50,
+	}
+
+	if got, expected := plan.Note(words(50)), (Estimate{Notes: 1, Calls: 1, InputTokens: 60, OutputTokens: 20}); got != expected {
+		t.Errorf("short note: expected %+v, got %+v", expected, got)
+	}
+
+	// 75 lines of 20 runes and 5 tokens are split into 3 chunks of 500 runes
+	long := strings.Repeat("word word word word\n", 75)
+	expected := Estimate{Notes: 1, Calls: 4, InputTokens: 375 + 3*5 + 10 + 3*50, OutputTokens: 3*50 + 20}
+	if got := plan.Note(long); got != expected {
+		t.Errorf("chunked note: expected %+v, got %+v", expected, got)
+	}
+
+	plan.Chunk = false
+	got := plan.Note(long)
+	if got.Calls != 1 || got.InputTokens >= 375 || got.OutputTokens != 20 {
+		t.Errorf("truncated note: unexpected %+v", got)
+	}
+
+	var total Estimate
+	total.Add(expected)
+	total.Add(expected)
+	if total.Notes != 2 || total.Calls != 8 {
+		t.Errorf("unexpected total %+v", total)
+	}
+	if cost := (Estimate{InputTokens: 2_000_000, OutputTokens: 1_000_000}).Cost(Price{Input: 0.15, Output: 0.60}); math.Abs(cost-0.90) > 1e-9 {
+		t.Errorf("expected $0.90, got $%v", cost)
+	}
+}
@@ -0,0 +1,69 @@
+package cost
+
+import (
+	"unicode/utf8"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/chunk"
+)
+
+// Estimate are the expected API calls and tokens of summarizing notes
+type Estimate struct {
+	Notes        int
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+}
+
+// Add adds the calls and tokens of o
+func (e *Estimate) Add(o Estimate) {
+	e.Notes += o.Notes
+	e.Calls += o.Calls
+	e.InputTokens += o.InputTokens
+	e.OutputTokens += o.OutputTokens
+}
+
+// Cost returns the costs in USD at price
+func (e Estimate) Cost(price Price) float64 {
+	return (float64(e.InputTokens)*price.Input + float64(e.OutputTokens)*price.Output) / 1_000_000
+}
+
+// Plan describes how notes are sent to the model
+type Plan struct {
+	Count Counter
+	// Prompt is the prompt template of a note, ChunkPrompt the one of a chunk of a long note
+	Prompt      string
+	ChunkPrompt string
+	// Limit is the maximum number of runes of a note sent in a single call, 0 for no limit
+	Limit int
+	// Chunk summarizes longer notes in chunks, else they are truncated
+	Chunk bool
+	// OutputTokens and ChunkOutputTokens are the expected output tokens of the summary of a note and a chunk
+	OutputTokens      int
+	ChunkOutputTokens int
+}
+
+// Note estimates the calls and tokens of summarizing the preprocessed text of a note
+func (p Plan) Note(text string) Estimate {
+	promptTokens := p.Count(p.Prompt)
+	if p.Limit <= 0 || utf8.RuneCountInString(text) <= p.Limit {
+		return Estimate{Notes: 1, Calls: 1, InputTokens: p.Count(text) + promptTokens, OutputTokens: p.OutputTokens}
+	}
+	if !p.Chunk {
+		truncated, _ := chunk.Truncate(text, p.Limit)
+		return Estimate{Notes: 1, Calls: 1, InputTokens: p.Count(truncated) + promptTokens, OutputTokens: p.OutputTokens}
+	}
+
+	// Every chunk is summarized on its own, then the summaries of all chunks together
+	chunks := chunk.Split(text, p.Limit)
+	chunkPromptTokens := p.Count(p.ChunkPrompt)
+	e := Estimate{Notes: 1}
+	for _, c := range chunks {
+		e.Calls++
+		e.InputTokens += p.Count(c) + chunkPromptTokens
+		e.OutputTokens += p.ChunkOutputTokens
+	}
+	e.Calls++
+	e.InputTokens += promptTokens + len(chunks)*p.ChunkOutputTokens
+	e.OutputTokens += p.OutputTokens
+	return e
+}
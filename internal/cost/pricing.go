@@ -0,0 +1,64 @@
+package cost
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Price is the price of a model in USD per million tokens
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// prices are the list prices of the models by name. Dated versions like gpt-4o-mini-2024-07-18
+// or claude-3-5-haiku-20241022 match their name, aliases are listed on their own.
+var prices = map[string]Price{
+	"gpt-4o-mini":              {Input: 0.15, Output: 0.60},
+	"gpt-4o":                   {Input: 2.50, Output: 10.00},
+	"gpt-4.1-nano":             {Input: 0.10, Output: 0.40},
+	"gpt-4.1-mini":             {Input: 0.40, Output: 1.60},
+	"gpt-4.1":                  {Input: 2.00, Output: 8.00},
+	"gpt-5-nano":               {Input: 0.05, Output: 0.40},
+	"gpt-5-mini":               {Input: 0.25, Output: 2.00},
+	"gpt-5":                    {Input: 1.25, Output: 10.00},
+	"o3-mini":                  {Input: 1.10, Output: 4.40},
+	"o3":                       {Input: 2.00, Output: 8.00},
+	"o4-mini":                  {Input: 1.10, Output: 4.40},
+	"claude-3-haiku":           {Input: 0.25, Output: 1.25},
+	"claude-3-5-haiku":         {Input: 0.80, Output: 4.00},
+	"claude-3-5-haiku-latest":  {Input: 0.80, Output: 4.00},
+	"claude-haiku-4-5":         {Input: 1.00, Output: 5.00},
+	"claude-3-5-sonnet":        {Input: 3.00, Output: 15.00},
+	"claude-3-5-sonnet-latest": {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet":        {Input: 3.00, Output: 15.00},
+	"claude-3-7-sonnet-latest": {Input: 3.00, Output: 15.00},
+	"claude-sonnet-4":          {Input: 3.00, Output: 15.00},
+	"claude-sonnet-4-0":        {Input: 3.00, Output: 15.00},
+	"claude-opus-4":            {Input: 15.00, Output: 75.00},
+	"claude-opus-4-0":          {Input: 15.00, Output: 75.00},
+	"claude-opus-4-1":          {Input: 15.00, Output: 75.00},
+}
+
+// dateSuffix matches the date of a dated model version, -YYYY-MM-DD of OpenAI or -YYYYMMDD of Anthropic
+var dateSuffix = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{8})$`)
+
+// freeProviders run the model locally
+var freeProviders = map[string]bool{
+	"ollama": true,
+}
+
+// Lookup returns the price of a model of a provider, found is false for unknown models.
+// Models match by their exact name or their name with a date suffix.
+func Lookup(provider, model string) (price Price, found bool) {
+	if freeProviders[provider] {
+		return Price{}, true
+	}
+	model = strings.ToLower(model)
+	if price, found = prices[model]; found {
+		return price, true
+	}
+	// Only dates are stripped, o3-pro is a different model than o3 and has a different price
+	price, found = prices[dateSuffix.ReplaceAllString(model, "")]
+	return price, found
+}
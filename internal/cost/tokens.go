@@ -0,0 +1,135 @@
+package cost
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+)
+
+// preTokenRegex splits text similar to the pre-tokenizer of OpenAI's cl100k and o200k BPE encodings:
+// contractions, words with a leading space or punctuation, groups of up to three digits,
+// punctuation runs and whitespace
+var preTokenRegex = regexp.MustCompile(`(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+`)
+
+// Counter returns the estimated number of tokens of a text
+type Counter func(text string) int
+
+// Count roughly estimates the tokens of text for models whose tokenizer is not built in. The text is
+// pre-tokenized similar to OpenAI's encodings and every piece is estimated by its length and script:
+// short words are one token, long words are split into pieces of about six letters, CJK characters are
+// a token each and other scripts about two characters per token. It is a heuristic, not a tokenizer.
+func Count(text string) int {
+	tokens := 0
+	for _, piece := range preTokenRegex.FindAllString(text, -1) {
+		tokens += pieceTokens(piece)
+	}
+	return tokens
+}
+
+// pieceTokens estimates the tokens of a single pre-token
+func pieceTokens(piece string) int {
+	var ascii, cjk, other int
+	for _, r := range piece {
+		switch {
+		case unicode.IsDigit(r):
+			// Digits are split into groups of up to three, a token each
+			return 1
+		case r < utf8.RuneSelf:
+			if unicode.IsLetter(r) {
+				ascii++
+			}
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			cjk++
+		case unicode.IsLetter(r):
+			other++
+		}
+	}
+
+	if ascii+cjk+other == 0 {
+		// Whitespace is a single token, punctuation runs merge into pairs
+		if strings.TrimSpace(piece) == "" {
+			return 1
+		}
+		return max(1, (utf8.RuneCountInString(strings.TrimSpace(piece))+1)/2)
+	}
+
+	tokens := cjk + (other+1)/2
+	if ascii > 0 {
+		tokens += max(1, int(math.Ceil(float64(ascii-2)/6)))
+	}
+	return tokens
+}
+
+// encodings are the BPE encodings of OpenAI models, matched by prefix of the model name.
+// The first match wins, so newer models are listed before the older ones they share a prefix with.
+var encodings = []struct {
+	prefix   string
+	encoding tokenizer.Encoding
+}{
+	{"gpt-4o", tokenizer.O200kBase},
+	{"chatgpt-4o", tokenizer.O200kBase},
+	{"gpt-4.1", tokenizer.O200kBase},
+	{"gpt-4.5", tokenizer.O200kBase},
+	{"gpt-5", tokenizer.O200kBase},
+	{"o1", tokenizer.O200kBase},
+	{"o3", tokenizer.O200kBase},
+	{"o4", tokenizer.O200kBase},
+	{"gpt-4", tokenizer.Cl100kBase},
+	{"gpt-3.5", tokenizer.Cl100kBase},
+	{"gpt-", tokenizer.O200kBase},
+}
+
+// family scales the estimate of Count to the tokenizer of other models
+type family struct {
+	prefix string
+	factor float64
+}
+
+// families are matched by prefix of the model name, the first match wins
+var families = []family{
+	// Claude's tokenizer needs noticeably more tokens for the same text
+	{"claude", 1.2},
+	// Llama 3 uses a tiktoken based vocabulary of similar size
+	{"llama3", 1.0},
+	{"llama", 1.1},
+}
+
+// unknownFactor is used for all other models
+const unknownFactor = 1.1
+
+// ForModel returns the counter for a model, e.g. "gpt-4o-mini" or "claude-3-5-haiku-latest".
+// OpenAI models are counted exactly with their BPE encoding, others are estimated by Count
+// scaled by the size of their vocabulary.
+func ForModel(model string) Counter {
+	model = strings.ToLower(model)
+	for _, e := range encodings {
+		if !strings.HasPrefix(model, e.prefix) {
+			continue
+		}
+		codec, err := tokenizer.Get(e.encoding)
+		if err != nil {
+			break
+		}
+		return func(text string) int {
+			if n, err := codec.Count(text); err == nil {
+				return n
+			}
+			return Count(text)
+		}
+	}
+
+	factor := unknownFactor
+	for _, f := range families {
+		if strings.HasPrefix(model, f.prefix) {
+			factor = f.factor
+			break
+		}
+	}
+	return func(text string) int {
+		return int(math.Round(float64(Count(text)) * factor))
+	}
+}
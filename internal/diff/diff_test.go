@@ -0,0 +1,89 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		context  int
+		expected string
+	}{
+		{
+			name: "Equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+		},
+		{
+			name: "Only line endings differ",
+			a:    "a\r\nb\r\n",
+			b:    "a\nb",
+		},
+		{
+			name:    "Replace a line",
+			a:       "---\ntitle: x\nsummarize_ai: \"old\"\n---\n",
+			b:       "---\ntitle: x\nsummarize_ai: \"new\"\n---\n",
+			context: 1,
+			expected: "--- a\n+++ b\n@@ -2,3 +2,3 @@\n" +
+				" title: x\n-summarize_ai: \"old\"\n+summarize_ai: \"new\"\n ---\n",
+		},
+		{
+			name:     "Insert into empty",
+			a:        "",
+			b:        "---\nk: v\n---\n",
+			context:  3,
+			expected: "--- a\n+++ b\n@@ -0,0 +1,3 @@\n+---\n+k: v\n+---\n",
+		},
+		{
+			name:    "Separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:       "1\nx\n3\n4\n5\n6\ny\n8\n",
+			context: 1,
+			expected: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n" +
+				"@@ -6,3 +6,3 @@\n 6\n-7\n+y\n 8\n",
+		},
+		{
+			name:     "Line endings are ignored",
+			a:        "a\r\nb\r\n",
+			b:        "a\nc\n",
+			context:  0,
+			expected: "--- a\n+++ b\n@@ -2 +2 @@\n-b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified(tt.a, tt.b, "a", "b", tt.context); got != tt.expected {
+				t.Errorf("expected:\n%s\ngot:\n%s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUnifiedLargeNote(t *testing.T) {
+	body := strings.Repeat("meeting log line\n", 20000)
+	a := "---\nsummarize_ai: \"old\"\n---\n" + body
+	b := "---\nsummarize_ai: \"new\"\n---\n" + body
+
+	allocs := testing.AllocsPerRun(1, func() {
+		Unified(a, b, "a", "b", 1)
+	})
+	if allocs > 1000 {
+		t.Errorf("expected the unchanged body to be skipped, got %.0f allocations", allocs)
+	}
+
+	expected := "--- a\n+++ b\n@@ -1,3 +1,3 @@\n ---\n-summarize_ai: \"old\"\n+summarize_ai: \"new\"\n ---\n"
+	if got := Unified(a, b, "a", "b", 1); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Changes at both ends leave a changed region too large for an LCS table
+	c := "x\n" + body + "y\n"
+	d := "z\n" + body + "w\n"
+	got := Unified(c, d, "c", "d", 0)
+	if !strings.HasPrefix(got, "--- c\n+++ d\n@@ -1,20002 +1,20002 @@\n-x\n") {
+		t.Errorf("unexpected diff of large changed region: %.80q", got)
+	}
+}
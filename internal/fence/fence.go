@@ -0,0 +1,108 @@
+package fence
+
+import (
+	"strings"
+)
+
+// Kind classifies a line of Markdown by its position relative to fenced code blocks
+type Kind int
+
+const (
+	// Text is a line outside of code blocks
+	Text Kind = iota
+	// Open is the opening fence of a code block
+	Open
+	// Code is a line inside a code block
+	Code
+	// Close is the closing fence of a code block
+	Close
+)
+
+// Parse reports whether line is a code fence: at least three backticks or tildes after any
+// indentation. fence are the fence characters and info the text following them.
+func Parse(line string) (fence, info string, ok bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, "~~~") {
+		return "", "", false
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	fence, info = trimmed[:n], strings.TrimSpace(trimmed[n:])
+	// The info string of a backtick fence cannot contain backticks, ```a``` is inline code
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return fence, info, true
+}
+
+// Scanner classifies the lines of a text one after another
+type Scanner struct {
+	fence string
+}
+
+// Next returns the kind of the next line. A block is closed by a fence of the same
+// character at least as long as the opening one and without info string.
+func (s *Scanner) Next(line string) Kind {
+	fence, info, ok := Parse(line)
+	switch {
+	case s.fence == "" && ok:
+		s.fence = fence
+		return Open
+	case s.fence == "":
+		return Text
+	case ok && info == "" && fence[0] == s.fence[0] && len(fence) >= len(s.fence):
+		s.fence = ""
+		return Close
+	default:
+		return Code
+	}
+}
+
+// Fence returns the opening fence of the block the scanner is in, empty outside of blocks
+func (s *Scanner) Fence() string {
+	return s.fence
+}
+
+// Block is a fenced code block of a text with byte offsets into it
+type Block struct {
+	// Start is the offset of the opening fence, End the offset after the closing fence
+	Start, End int
+	// ContentStart and ContentEnd delimit the lines between the fences
+	ContentStart, ContentEnd int
+	// Fence is the opening fence, Lang the lower case first word of its info string
+	Fence, Lang string
+	// Closed is false for a block reaching to the end of the text
+	Closed bool
+}
+
+// Blocks returns the fenced code blocks of text, an unclosed block reaches to the end of text
+func Blocks(text string) []Block {
+	var blocks []Block
+	var s Scanner
+	var current Block
+	for offset := 0; offset < len(text); {
+		end := strings.IndexByte(text[offset:], '\n')
+		if end < 0 {
+			end = len(text)
+		} else {
+			end += offset + 1
+		}
+
+		switch s.Next(text[offset:end]) {
+		case Open:
+			_, info, _ := Parse(text[offset:end])
+			current = Block{Start: offset, ContentStart: end, Fence: s.Fence()}
+			if fields := strings.Fields(info); len(fields) > 0 {
+				current.Lang = strings.ToLower(fields[0])
+			}
+		case Close:
+			current.ContentEnd, current.End, current.Closed = offset, end, true
+			blocks = append(blocks, current)
+		}
+		offset = end
+	}
+	if s.Fence() != "" {
+		current.ContentEnd, current.End = len(text), len(text)
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
@@ -0,0 +1,37 @@
+package fence
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	lines := []string{"text", "  ````Go run", "```", "~~~", "```` not closing", "\t````", "```a``` inline", "~~~", "code", ""}
+	expected := []Kind{Text, Open, Code, Code, Code, Close, Text, Open, Code, Code}
+
+	var s Scanner
+	var got []Kind
+	for _, line := range lines {
+		got = append(got, s.Next(line))
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if s.Fence() != "~~~" {
+		t.Errorf("expected the ~~~ block to be open, got %q", s.Fence())
+	}
+}
+
+func TestBlocks(t *testing.T) {
+	text := "a\n```Dataview extra\nLIST\n```\nb\n~~~~\nx\n"
+	expected := []Block{
+		{Start: 2, End: 29, ContentStart: 20, ContentEnd: 25, Fence: "```", Lang: "dataview", Closed: true},
+		{Start: 31, End: 38, ContentStart: 36, ContentEnd: 38, Fence: "~~~~"},
+	}
+	if got := Blocks(text); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if got := Blocks("no code\n"); got != nil {
+		t.Errorf("expected no blocks, got %+v", got)
+	}
+}
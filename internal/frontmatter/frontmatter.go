@@ -2,119 +2,537 @@ package frontmatter
 
 import (
 	"fmt"
-	"os"
+	"reflect"
+	"sort"
 	"strings"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/tags"
+	"gopkg.in/yaml.v3"
 )
 
-// UpdateFrontmatter updates (or creates) only the summarize_ai, summarize_ai_hash,
-// and summarize_ai_tags keys in the frontmatter, leaving all other text content untouched.
-func UpdateFrontmatter(filePath, summary string, tags []string, hash string) error {
-	// Read the original file content.
-	contentBytes, err := os.ReadFile(filePath)
+// Option configures Update
+type Option func(*options)
+
+type options struct {
+	schema      Schema
+	mergeTags   bool
+	contentHash string
+	model       string
+}
+
+func newOptions(opts []Option) options {
+	o := options{schema: DefaultSchema}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithSchema writes the values to the keys of schema instead of DefaultSchema
+func WithSchema(schema Schema) Option {
+	return func(o *options) {
+		o.schema = schema
+	}
+}
+
+// MergeTags unions the tags into the existing tags of the tags key instead of replacing them.
+// The new tags are normalized to Obsidian tag syntax, tags already present (ignoring case) are
+// skipped and the added ones are recorded under the added tags key of the schema. Tags recorded
+// by a previous run are replaced.
+func MergeTags(merge bool) Option {
+	return func(o *options) {
+		o.mergeTags = merge
+	}
+}
+
+// WithContentHash records the hash of the summarized content (see ContentHash) under the content hash key
+func WithContentHash(hash string) Option {
+	return func(o *options) {
+		o.contentHash = hash
+	}
+}
+
+// WithModel records the model which created the summary under the model key
+func WithModel(model string) Option {
+	return func(o *options) {
+		o.model = model
+	}
+}
+
+// Update returns content with the summary, hash and tags keys of the frontmatter replaced or added.
+// Only the lines of these keys are touched, comments, key order, quoting and formatting of all
+// other keys as well as the body stay byte-for-byte.
+func Update(content, summary string, tags []string, hash string, opts ...Option) (string, error) {
+	o := newOptions(opts)
+	if err := o.schema.Validate(); err != nil {
+		return "", err
+	}
+
+	eol := "\n"
+	if strings.Contains(content, "\r\n") {
+		eol = "\r\n"
+	}
+
+	front, remainder, hasFront, err := split(content)
+	if err != nil {
+		return "", err
+	}
+
+	// The values in the order they are appended when missing, empty tags remove the key
+	edits := []fieldEdit{
+		{splitKey(o.schema.SummaryKey), scalarNode(summary, yaml.DoubleQuotedStyle)},
+		{splitKey(o.schema.HashKey), scalarNode(hash, 0)},
+	}
+	if o.schema.ContentHashKey != "" && o.contentHash != "" {
+		edits = append(edits, fieldEdit{splitKey(o.schema.ContentHashKey), scalarNode(o.contentHash, 0)})
+	}
+	if o.schema.ModelKey != "" && o.model != "" {
+		edits = append(edits, fieldEdit{splitKey(o.schema.ModelKey), scalarNode(o.model, 0)})
+	}
+	if o.mergeTags {
+		tagEdits, err := mergeTagEdits(front, o.schema, tags)
+		if err != nil {
+			return "", err
+		}
+		edits = append(edits, tagEdits...)
+	} else if o.schema.TagsKey != "" {
+		var tagsNode *yaml.Node
+		if len(tags) > 0 {
+			tagsNode = listNode(tags)
+		}
+		edits = append(edits, fieldEdit{splitKey(o.schema.TagsKey), tagsNode})
+	}
+
+	if !hasFront {
+		// No frontmatter exists: create a new frontmatter block and prepend it.
+		newFront, err := applyFieldEdits(nil, edits)
+		if err != nil {
+			return "", err
+		}
+		if err := validate(newFront, edits); err != nil {
+			return "", err
+		}
+		newFrontmatter := "---" + eol + strings.Join(newFront, eol) + eol + "---"
+		if content != "" {
+			return newFrontmatter + eol + content, nil
+		}
+		return newFrontmatter, nil
+	}
+
+	newFront, err := applyFieldEdits(front, edits)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
-	}
-	content := string(contentBytes)
-
-	// Check if file starts with a frontmatter block.
-	if strings.HasPrefix(content, "---") {
-		// Split content into lines.
-		lines := strings.Split(content, "\n")
-		// Find the closing delimiter line (the second occurrence of a line that equals '---').
-		closingIndex := -1
-		for i := 1; i < len(lines); i++ {
-			if strings.TrimSpace(lines[i]) == "---" {
-				closingIndex = i
-				break
+		return "", err
+	}
+	if err := validate(newFront, edits); err != nil {
+		return "", err
+	}
+
+	// Reassemble the frontmatter block exactly, keeping the remainder as-is.
+	// Do not add any extra newline at the end.
+	newFrontmatter := "---" + eol
+	for _, line := range newFront {
+		newFrontmatter += strings.TrimSuffix(line, "\r") + eol
+	}
+	return newFrontmatter + remainder, nil
+}
+
+// split separates the frontmatter lines (without delimiters and line endings) from the
+// rest of the content, which starts with the closing delimiter line
+func split(content string) (front []string, remainder string, ok bool, err error) {
+	if !strings.HasPrefix(content, "---") {
+		return nil, content, false, nil
+	}
+
+	lines := strings.SplitAfter(content, "\n")
+	if !isDelimiter(lines[0]) {
+		return nil, content, false, nil
+	}
+
+	// Find the closing delimiter line (the second occurrence of a line that equals '---').
+	for i := 1; i < len(lines); i++ {
+		if isDelimiter(lines[i]) {
+			for _, line := range lines[1:i] {
+				front = append(front, strings.TrimSuffix(line, "\n"))
 			}
+			return front, strings.Join(lines[i:], ""), true, nil
 		}
-		if closingIndex == -1 {
-			return fmt.Errorf("no closing frontmatter delimiter found")
-		}
-
-		// Process the existing frontmatter (lines[1:closingIndex]).
-		frontLines := lines[1:closingIndex]
-		var newFront []string
-		updatedAI, updatedHash, updatedTags := false, false, false
-
-		for i := 0; i < len(frontLines); i++ {
-			line := frontLines[i]
-			trimmed := strings.TrimSpace(line)
-			if strings.HasPrefix(trimmed, "summarize_ai:") && !strings.HasPrefix(trimmed, "summarize_ai_hash:") {
-				newFront = append(newFront, fmt.Sprintf("summarize_ai: \"%s\"", summary))
-				updatedAI = true
-			} else if strings.HasPrefix(trimmed, "summarize_ai_hash:") {
-				newFront = append(newFront, "summarize_ai_hash: "+hash)
-				updatedHash = true
-			} else if strings.HasPrefix(trimmed, "summarize_ai_tags:") {
-				// Skip this line and the following indented lines.
-				if len(tags) > 0 {
-					newFront = append(newFront, "summarize_ai_tags:")
-					for _, tag := range tags {
-						newFront = append(newFront, "  - "+tag)
-					}
-				}
-				updatedTags = true
-				// Skip all subsequent indented lines.
-				j := i + 1
-				for j < len(frontLines) && frontLines[j] != "" && (frontLines[j][0] == ' ' || frontLines[j][0] == '\t') {
-					j++
+	}
+	return nil, "", false, fmt.Errorf("no closing frontmatter delimiter found")
+}
+
+// isDelimiter reports whether line is a frontmatter delimiter. Indented lines are not,
+// as they can be part of a block scalar.
+func isDelimiter(line string) bool {
+	return strings.TrimRight(line, " \t\r\n") == "---"
+}
+
+// fieldEdit sets the key path to value, a nil value removes the key
+type fieldEdit struct {
+	path  []string
+	value *yaml.Node
+}
+
+// lineEdit replaces the lines [start, end) with lines, start == end inserts before start
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// applyFieldEdits applies edits to the frontmatter lines by locating the keys in a YAML node tree.
+// Frontmatter which is no valid YAML, e.g. corrupted by hand or by an older version of this tool,
+// falls back to scanning for unindented keys, which only supports top-level keys.
+func applyFieldEdits(front []string, edits []fieldEdit) ([]string, error) {
+	var doc yaml.Node
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &doc); err == nil {
+		if len(doc.Content) > 0 {
+			root = doc.Content[0]
+			if root.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("frontmatter is not a YAML mapping")
+			}
+		}
+	} else {
+		for _, e := range edits {
+			if len(e.path) > 1 {
+				return nil, fmt.Errorf("failed to parse frontmatter: %w", err)
+			}
+		}
+		root = scanMapping(front)
+	}
+
+	lineEdits, err := editMapping(front, root, len(front), 0, len(front), edits)
+	if err != nil {
+		return nil, err
+	}
+	return applyLineEdits(front, lineEdits), nil
+}
+
+// editMapping computes the line edits for a block mapping whose keys end at regionEnd.
+// New keys are inserted at insertAt with the given indentation.
+func editMapping(front []string, mapping *yaml.Node, regionEnd, indent, insertAt int, edits []fieldEdit) ([]lineEdit, error) {
+	// Group the edits by the first path segment, keeping their order
+	var names []string
+	groups := map[string][]fieldEdit{}
+	for _, e := range edits {
+		name := e.path[0]
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], fieldEdit{e.path[1:], e.value})
+	}
+
+	var lineEdits []lineEdit
+	for _, name := range names {
+		group := groups[name]
+
+		var found []int
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == name {
+				found = append(found, i)
+			}
+		}
+
+		if len(found) == 0 {
+			node := buildNode(group)
+			if node == nil {
+				continue
+			}
+			lines, err := renderValue(name, node)
+			if err != nil {
+				return nil, err
+			}
+			lineEdits = append(lineEdits, lineEdit{insertAt, insertAt, indentLines(lines, indent)})
+			continue
+		}
+
+		// Duplicate keys can only occur in broken frontmatter, the first one is kept
+		for _, i := range found[1:] {
+			span := childSpan(front, mapping, i, regionEnd)
+			lineEdits = append(lineEdits, lineEdit{span.start, span.end, nil})
+		}
+
+		i := found[0]
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		span := childSpan(front, mapping, i, regionEnd)
+		column := key.Column - 1
+
+		if len(group) == 1 && len(group[0].path) == 0 {
+			var lines []string
+			if group[0].value != nil {
+				rendered, err := renderValue(name, group[0].value)
+				if err != nil {
+					return nil, err
 				}
-				i = j - 1 // Adjust loop index.
-			} else {
-				newFront = append(newFront, line)
+				lines = indentLines(rendered, column)
 			}
+			lineEdits = append(lineEdits, lineEdit{span.start, span.end, lines})
+			continue
 		}
 
-		// If any key is missing, add it.
-		if !updatedAI {
-			newFront = append(newFront, fmt.Sprintf("summarize_ai: \"%s\"", summary))
+		switch {
+		case value.Kind == yaml.MappingNode && value.Style&yaml.FlowStyle == 0 && len(value.Content) > 0:
+			// Descend into the block mapping, only touching the lines of our keys
+			childIndent := value.Content[0].Column - 1
+			nested, err := editMapping(front, value, span.end, childIndent, span.end, group)
+			if err != nil {
+				return nil, err
+			}
+			lineEdits = append(lineEdits, nested...)
+		case value.Kind == yaml.MappingNode || value.Tag == "!!null":
+			// Flow mappings and empty values are re-rendered as block mapping
+			if value.Kind != yaml.MappingNode {
+				value = &yaml.Node{Kind: yaml.MappingNode}
+			}
+			value.Style = 0
+			for _, e := range group {
+				setPath(value, e.path, e.value)
+			}
+			rendered, err := renderValue(name, value)
+			if err != nil {
+				return nil, err
+			}
+			lineEdits = append(lineEdits, lineEdit{span.start, span.end, indentLines(rendered, column)})
+		default:
+			return nil, fmt.Errorf("cannot write %s.%s: %s is not a mapping", name, strings.Join(group[0].path, "."), name)
 		}
-		if !updatedHash {
-			newFront = append(newFront, "summarize_ai_hash: "+hash)
+	}
+	return lineEdits, nil
+}
+
+// childSpan returns the lines of the key at index i of mapping including its value
+func childSpan(front []string, mapping *yaml.Node, i, regionEnd int) keySpan {
+	start := mapping.Content[i].Line - 1
+	limit := regionEnd
+	if i+2 < len(mapping.Content) {
+		limit = mapping.Content[i+2].Line - 1
+	}
+	return keySpan{start, valueEnd(front, start, limit, mapping.Content[i].Column-1)}
+}
+
+// buildNode creates the node for a missing key from the edits below it, nil if there is nothing to write
+func buildNode(edits []fieldEdit) *yaml.Node {
+	if len(edits) == 1 && len(edits[0].path) == 0 {
+		return edits[0].value
+	}
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, e := range edits {
+		setPath(node, e.path, e.value)
+	}
+	if len(node.Content) == 0 {
+		return nil
+	}
+	return node
+}
+
+// setPath sets the key path within mapping to value, creating intermediate mappings.
+// A nil value removes the key.
+func setPath(mapping *yaml.Node, path []string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != path[0] {
+			continue
 		}
-		if !updatedTags && len(tags) > 0 {
-			newFront = append(newFront, "summarize_ai_tags:")
-			for _, tag := range tags {
-				newFront = append(newFront, "  - "+tag)
+		if len(path) == 1 {
+			if value == nil {
+				mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			} else {
+				mapping.Content[i+1] = value
 			}
+			return
 		}
+		child := mapping.Content[i+1]
+		if child.Kind != yaml.MappingNode {
+			child = &yaml.Node{Kind: yaml.MappingNode}
+			mapping.Content[i+1] = child
+		}
+		setPath(child, path[1:], value)
+		return
+	}
 
-		// Reassemble the frontmatter block exactly.
-		newFrontmatter := "---\n" + strings.Join(newFront, "\n") + "\n---"
+	if value == nil {
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: path[0]}
+	if len(path) == 1 {
+		mapping.Content = append(mapping.Content, key, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode}
+	setPath(child, path[1:], value)
+	mapping.Content = append(mapping.Content, key, child)
+}
 
-		// Reassemble the final file content:
-		// Keep the remainder (after the frontmatter) exactly as-is.
-		remainder := ""
-		if closingIndex+1 < len(lines) {
-			remainder = strings.Join(lines[closingIndex+1:], "\n")
+// applyLineEdits returns front with all non-overlapping edits applied
+func applyLineEdits(front []string, edits []lineEdit) []string {
+	sort.SliceStable(edits, func(a, b int) bool {
+		if edits[a].start != edits[b].start {
+			return edits[a].start < edits[b].start
 		}
-		finalContent := ""
-		if remainder != "" {
-			finalContent = newFrontmatter + "\n" + remainder
-		} else {
-			finalContent = newFrontmatter
+		// insertions go before a replacement at the same line
+		return edits[a].start == edits[a].end && edits[b].start != edits[b].end
+	})
+
+	var result []string
+	next := 0
+	for _, e := range edits {
+		result = append(result, front[next:e.start]...)
+		result = append(result, e.lines...)
+		next = max(next, e.end)
+	}
+	return append(result, front[next:]...)
+}
+
+// keySpan is the line range [start, end) of a key including its value
+type keySpan struct {
+	start, end int
+}
+
+// scanMapping builds a mapping node of the unindented keys of frontmatter which is no valid YAML.
+// The values are unknown and represented as empty strings.
+func scanMapping(front []string) *yaml.Node {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	for i, line := range front {
+		if line == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '#' || line[0] == '-' {
+			continue
+		}
+		if key, _, found := strings.Cut(line, ":"); found {
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: strings.Trim(strings.TrimSpace(key), `"'`), Line: i + 1, Column: 1},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str"},
+			)
+		}
+	}
+	return mapping
+}
+
+// scanKeySpans returns the spans of the unindented keys of frontmatter which is no valid YAML
+func scanKeySpans(front []string) map[string][]keySpan {
+	mapping := scanMapping(front)
+	spans := map[string][]keySpan{}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		name := mapping.Content[i].Value
+		spans[name] = append(spans[name], childSpan(front, mapping, i, len(front)))
+	}
+	return spans
+}
+
+// valueEnd returns the end of the value of the key at line start and the given column.
+// Trailing blank lines and comments not indented deeper than the key belong to the next key
+// and are not included.
+func valueEnd(front []string, start, limit, column int) int {
+	end := start + 1
+	for i := start + 1; i < limit; i++ {
+		line := strings.TrimSuffix(front[i], "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || (trimmed[0] == '#' && len(line)-len(trimmed) <= column) {
+			continue
 		}
-		// Do not add any extra newline at the end.
-		return os.WriteFile(filePath, []byte(finalContent), os.ModePerm)
+		end = i + 1
+	}
+	return end
+}
+
+func indentLines(lines []string, indent int) []string {
+	if indent == 0 {
+		return lines
+	}
+	prefix := strings.Repeat(" ", indent)
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = prefix + line
+	}
+	return result
+}
+
+func scalarNode(value string, style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+func listNode(values []string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, v := range values {
+		node.Content = append(node.Content, scalarNode(v, 0))
+	}
+	return node
+}
+
+// renderValue serializes key and value with a YAML encoder, which quotes or escapes
+// any value that would otherwise be invalid YAML or change its type
+func renderValue(key string, value *yaml.Node) ([]string, error) {
+	doc := &yaml.Node{
+		Kind:    yaml.MappingNode,
+		Content: []*yaml.Node{{Kind: yaml.ScalarNode, Value: key}, value},
+	}
+
+	var b strings.Builder
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n"), nil
+}
+
+// mergeTagEdits returns the edits of the tags key and the added tags key for merging tags into
+// the existing ones. A tags key holding a comma separated string keeps that form.
+func mergeTagEdits(front []string, schema Schema, aiTags []string) ([]fieldEdit, error) {
+	if schema.TagsKey == "" || schema.AddedTagsKey == "" {
+		return nil, fmt.Errorf("merging tags requires a tags key and an added tags key")
 	}
 
-	// No frontmatter exists: create a new frontmatter block and prepend it.
-	var front []string
-	front = append(front, fmt.Sprintf("summarize_ai: \"%s\"", summary))
-	front = append(front, "summarize_ai_hash: "+hash)
-	if len(tags) > 0 {
-		front = append(front, "summarize_ai_tags:")
-		for _, tag := range tags {
-			front = append(front, "  - "+tag)
+	var data map[string]any
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &data); err != nil {
+		return nil, fmt.Errorf("failed to parse frontmatter: %w", err)
+	}
+
+	existingValue, _ := lookup(data, schema.TagsKey)
+	previousValue, _ := lookup(data, schema.AddedTagsKey)
+	existing := tags.Remove(toStrings(existingValue), toStrings(previousValue))
+	merged, added := tags.Merge(existing, aiTags)
+
+	var tagsNode, addedNode *yaml.Node
+	if len(merged) > 0 {
+		if _, isString := existingValue.(string); isString {
+			tagsNode = scalarNode(strings.Join(merged, ", "), 0)
+		} else {
+			tagsNode = listNode(merged)
 		}
 	}
-	newFrontmatter := "---\n" + strings.Join(front, "\n") + "\n---"
-	finalContent := ""
-	if content != "" {
-		finalContent = newFrontmatter + "\n" + content
-	} else {
-		finalContent = newFrontmatter
+	if len(added) > 0 {
+		addedNode = listNode(added)
+	}
+	return []fieldEdit{
+		{splitKey(schema.TagsKey), tagsNode},
+		{splitKey(schema.AddedTagsKey), addedNode},
+	}, nil
+}
+
+// validate parses the new frontmatter and checks that it is valid YAML containing exactly
+// the written values, so a note is never left with frontmatter Obsidian refuses to parse
+func validate(front []string, edits []fieldEdit) error {
+	var data map[string]any
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &data); err != nil {
+		return fmt.Errorf("refusing to write invalid frontmatter: %w", err)
+	}
+
+	for _, e := range edits {
+		key := strings.Join(e.path, ".")
+		got, found := lookup(data, key)
+		if e.value == nil {
+			if found {
+				return fmt.Errorf("refusing to write frontmatter: %s was not removed", key)
+			}
+			continue
+		}
+		var want any
+		if err := e.value.Decode(&want); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", key, err)
+		}
+		if !found || !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("refusing to write frontmatter: %s does not round-trip", key)
+		}
 	}
-	return os.WriteFile(filePath, []byte(finalContent), os.ModePerm)
+	return nil
 }
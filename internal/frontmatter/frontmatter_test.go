@@ -1,11 +1,12 @@
 package frontmatter
 
 import (
-	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
-func TestUpdateFrontmatter(t *testing.T) {
+func TestUpdate(t *testing.T) {
 	tests := []struct {
 		name            string
 		initialContent  string
@@ -125,32 +126,13 @@ Content below frontmatter.
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a temporary file
-			tmpFile, err := os.CreateTemp("", "testfile-*.md")
+			updatedContent, err := Update(tt.initialContent, tt.summary, nil, tt.hash)
 			if err != nil {
-				t.Fatalf("Failed to create temp file: %v", err)
-			}
-			defer os.Remove(tmpFile.Name())
-
-			// Write initial content to the file
-			if _, err := tmpFile.Write([]byte(tt.initialContent)); err != nil {
-				t.Fatalf("Failed to write to temp file: %v", err)
-			}
-			tmpFile.Close()
-
-			// Call UpdateFrontmatter
-			if err := UpdateFrontmatter(tmpFile.Name(), tt.summary, nil, tt.hash); err != nil {
-				t.Fatalf("UpdateFrontmatter failed: %v", err)
-			}
-
-			// Read the updated content
-			updatedContent, err := os.ReadFile(tmpFile.Name())
-			if err != nil {
-				t.Fatalf("Failed to read updated file: %v", err)
+				t.Fatalf("Update failed: %v", err)
 			}
 
 			// Compare the updated content with the expected content
-			if string(updatedContent) != tt.expectedContent {
+			if updatedContent != tt.expectedContent {
 				// Find the first differing character
 				minLen := min(len(updatedContent), len(tt.expectedContent))
 				var diffIndex int
@@ -160,14 +142,14 @@ Content below frontmatter.
 					}
 				}
 				t.Errorf("Content mismatch.\nExpected:\n%s\nGot:\n%s\nFirst difference at index %d: expected '%c' (0x%x), got '%c' (0x%x)",
-					tt.expectedContent, string(updatedContent), diffIndex, tt.expectedContent[diffIndex], tt.expectedContent[diffIndex],
+					tt.expectedContent, updatedContent, diffIndex, tt.expectedContent[diffIndex], tt.expectedContent[diffIndex],
 					updatedContent[diffIndex], updatedContent[diffIndex])
 			}
 		})
 	}
 }
 
-func TestUpdateFrontmatterWithTags(t *testing.T) {
+func TestUpdateWithTags(t *testing.T) {
 	tests := []struct {
 		name            string
 		initialContent  string
@@ -257,29 +239,557 @@ Content here
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tmpFile, err := os.CreateTemp("", "testfile-*.md")
+			updatedContent, err := Update(tt.initialContent, tt.summary, tt.tags, tt.hash)
 			if err != nil {
-				t.Fatalf("Failed to create temp file: %v", err)
+				t.Fatalf("Update failed: %v", err)
+			}
+			if updatedContent != tt.expectedContent {
+				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, updatedContent)
 			}
-			defer os.Remove(tmpFile.Name())
+		})
+	}
+}
+
+func TestUpdateRoundTrip(t *testing.T) {
+	tests := []struct {
+		name            string
+		initialContent  string
+		expectedContent string
+		tags            []string
+	}{
+		{
+			name: "Comments, key order and quoting are preserved",
+			initialContent: `---
+# leading comment
+title:   'Single quoted'   # trailing comment
+aliases: ["a", 'b']
+summarize_ai: "Old summary"
+date: 2024-01-01
+---
+Body
+`,
+			expectedContent: `---
+# leading comment
+title:   'Single quoted'   # trailing comment
+aliases: ["a", 'b']
+summarize_ai: "Test summary"
+date: 2024-01-01
+summarize_ai_hash: TestHash
+---
+Body
+`,
+		},
+		{
+			name: "Nested keys with the same names are not touched",
+			initialContent: `---
+meta:
+  summarize_ai: nested
+  summarize_ai_tags:
+    - nested
+---
+Body
+`,
+			expectedContent: `---
+meta:
+  summarize_ai: nested
+  summarize_ai_tags:
+    - nested
+summarize_ai: "Test summary"
+summarize_ai_hash: TestHash
+---
+Body
+`,
+		},
+		{
+			name: "Block scalar values are replaced completely",
+			initialContent: `---
+summarize_ai: |
+  First line
+  summarize_ai_hash: not a key
+
+  Last line
+other: value
+---
+Body
+`,
+			expectedContent: `---
+summarize_ai: "Test summary"
+other: value
+summarize_ai_hash: TestHash
+---
+Body
+`,
+		},
+		{
+			name: "Block scalars of other keys containing our keys are kept",
+			initialContent: `---
+notes: >
+  summarize_ai: this is text
+  summarize_ai_tags:
+---
+Body
+`,
+			expectedContent: `---
+notes: >
+  summarize_ai: this is text
+  summarize_ai_tags:
+summarize_ai: "Test summary"
+summarize_ai_hash: TestHash
+---
+Body
+`,
+		},
+		{
+			name: "Multi-line quoted value and unindented tag list",
+			initialContent: `---
+summarize_ai: "a summary
+  spanning lines"
+summarize_ai_tags:
+- old1
+- old2
+
+# comment of next key
+next: value
+---
+Body
+`,
+			expectedContent: `---
+summarize_ai: "Test summary"
+summarize_ai_tags:
+  - new
+  - tags
 
-			if _, err := tmpFile.Write([]byte(tt.initialContent)); err != nil {
-				t.Fatalf("Failed to write to temp file: %v", err)
+# comment of next key
+next: value
+summarize_ai_hash: TestHash
+---
+Body
+`,
+			tags: []string{"new", "tags"},
+		},
+		{
+			name:            "Windows line endings are kept",
+			initialContent:  "---\r\ntitle: x\r\nsummarize_ai: old\r\n---\r\nBody\r\n",
+			expectedContent: "---\r\ntitle: x\r\nsummarize_ai: \"Test summary\"\r\nsummarize_ai_hash: TestHash\r\n---\r\nBody\r\n",
+		},
+		{
+			name:            "Empty frontmatter",
+			initialContent:  "---\n---\nBody",
+			expectedContent: "---\nsummarize_ai: \"Test summary\"\nsummarize_ai_hash: TestHash\n---\nBody",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Update(tt.initialContent, "Test summary", tt.tags, "TestHash")
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
 			}
-			tmpFile.Close()
+			if got != tt.expectedContent {
+				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, got)
+			}
+		})
+	}
+}
 
-			if err := UpdateFrontmatter(tmpFile.Name(), tt.summary, tt.tags, tt.hash); err != nil {
-				t.Fatalf("UpdateFrontmatter failed: %v", err)
+func TestUpdateErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"No closing delimiter":      "---\ntitle: x\nBody",
+		"Frontmatter is a sequence": "---\n- a\n- b\n---\nBody",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Update(content, "Test summary", nil, "TestHash"); err == nil {
+				t.Error("Expected error")
 			}
+		})
+	}
+}
 
-			updatedContent, err := os.ReadFile(tmpFile.Name())
+func TestUpdateEscaping(t *testing.T) {
+	tests := []struct {
+		name            string
+		initialContent  string
+		summary         string
+		tags            []string
+		expectedContent string
+	}{
+		{
+			name:           "Quotes, backslashes and newlines in the summary",
+			initialContent: "Body",
+			summary:        "He said \"hi\" C:\\path\nsecond line",
+			expectedContent: `---
+summarize_ai: "He said \"hi\" C:\\path\nsecond line"
+summarize_ai_hash: TestHash
+---
+Body`,
+		},
+		{
+			name:           "Tags needing quotes",
+			initialContent: "Body",
+			summary:        "Test summary",
+			tags:           []string{"#foo: bar", "plain", "1234", "- dash"},
+			expectedContent: `---
+summarize_ai: "Test summary"
+summarize_ai_hash: TestHash
+summarize_ai_tags:
+  - '#foo: bar'
+  - plain
+  - "1234"
+  - '- dash'
+---
+Body`,
+		},
+		{
+			name: "Previously corrupted summary is repaired",
+			initialContent: `---
+title: x
+summarize_ai: "He said "hi""
+---
+Body`,
+			summary: `He said "hi"`,
+			expectedContent: `---
+title: x
+summarize_ai: "He said \"hi\""
+summarize_ai_hash: TestHash
+---
+Body`,
+		},
+		{
+			name:           "Summary containing a delimiter line",
+			initialContent: "Body",
+			summary:        "a\n---\nb",
+			expectedContent: `---
+summarize_ai: "a\n---\nb"
+summarize_ai_hash: TestHash
+---
+Body`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Update(tt.initialContent, tt.summary, tt.tags, "TestHash")
 			if err != nil {
-				t.Fatalf("Failed to read updated file: %v", err)
+				t.Fatalf("Update failed: %v", err)
+			}
+			if got != tt.expectedContent {
+				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, got)
 			}
+		})
+	}
+}
+
+func TestUpdateRefusesToCorrupt(t *testing.T) {
+	// The frontmatter is broken outside of our keys, writing would not make it valid
+	content := "---\ntitle: \"unterminated\nsummarize_ai: old\n---\nBody"
+	if _, err := Update(content, "Test summary", nil, "TestHash"); err == nil {
+		t.Fatal("Expected error for invalid frontmatter")
+	}
+}
+
+func TestUpdateWithSchema(t *testing.T) {
+	dataview := Schema{SummaryKey: "description", HashKey: "ai.hash", TagsKey: "ai.tags"}
+
+	tests := []struct {
+		name            string
+		schema          Schema
+		initialContent  string
+		tags            []string
+		expectedContent string
+	}{
+		{
+			name:           "Nested keys are created",
+			schema:         dataview,
+			initialContent: "---\ntitle: x\n---\nBody",
+			tags:           []string{"a", "b"},
+			expectedContent: `---
+title: x
+description: "Test summary"
+ai:
+  hash: TestHash
+  tags:
+    - a
+    - b
+---
+Body`,
+		},
+		{
+			name:   "Nested keys are updated in an existing block mapping",
+			schema: dataview,
+			initialContent: `---
+description: old
+ai:
+    # keep this comment
+    model: gpt
+    hash: OldHash
+    tags: [old]
+    other: value
+title: x
+---
+Body`,
+			tags: []string{"new"},
+			expectedContent: `---
+description: "Test summary"
+ai:
+    # keep this comment
+    model: gpt
+    hash: TestHash
+    tags:
+      - new
+    other: value
+title: x
+---
+Body`,
+		},
+		{
+			name:   "Missing nested key is appended to its mapping",
+			schema: Schema{SummaryKey: "ai.summary", HashKey: "ai.hash"},
+			initialContent: `---
+ai:
+  model: gpt
+
+# comment of title
+title: x
+---
+Body`,
+			expectedContent: `---
+ai:
+  model: gpt
+  summary: "Test summary"
+  hash: TestHash
 
-			if string(updatedContent) != tt.expectedContent {
-				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, string(updatedContent))
+# comment of title
+title: x
+---
+Body`,
+		},
+		{
+			name:            "Flow mapping is rewritten as block mapping",
+			schema:          Schema{SummaryKey: "ai.summary", HashKey: "ai.hash"},
+			initialContent:  "---\nai: {model: gpt}\n---\nBody",
+			expectedContent: "---\nai:\n  model: gpt\n  summary: \"Test summary\"\n  hash: TestHash\n---\nBody",
+		},
+		{
+			name:            "Empty parent becomes a mapping",
+			schema:          Schema{SummaryKey: "ai.summary", HashKey: "ai.hash"},
+			initialContent:  "---\nai:\ntitle: x\n---\nBody",
+			expectedContent: "---\nai:\n  summary: \"Test summary\"\n  hash: TestHash\ntitle: x\n---\nBody",
+		},
+		{
+			name:            "Native tags key",
+			schema:          Schema{SummaryKey: "summary", HashKey: "summary_hash", TagsKey: "tags"},
+			initialContent:  "---\ntags:\n  - old\n---\nBody",
+			tags:            []string{"new"},
+			expectedContent: "---\ntags:\n  - new\nsummary: \"Test summary\"\nsummary_hash: TestHash\n---\nBody",
+		},
+		{
+			name:            "Tags can be disabled",
+			schema:          Schema{SummaryKey: "summary", HashKey: "summary_hash"},
+			initialContent:  "Body",
+			tags:            []string{"ignored"},
+			expectedContent: "---\nsummary: \"Test summary\"\nsummary_hash: TestHash\n---\nBody",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Update(tt.initialContent, "Test summary", tt.tags, "TestHash", WithSchema(tt.schema))
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if got != tt.expectedContent {
+				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, got)
+			}
+
+			values, found, err := Read(got, tt.schema)
+			if err != nil || !found {
+				t.Fatalf("Read failed: found=%v, err=%v", found, err)
+			}
+			if values.Summary != "Test summary" || values.Hash != "TestHash" {
+				t.Errorf("Unexpected values: %+v", values)
 			}
 		})
 	}
+
+	t.Run("Parent is a scalar", func(t *testing.T) {
+		if _, err := Update("---\nai: text\n---\n", "Test summary", nil, "TestHash", WithSchema(dataview)); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
+
+func TestUpdateMergeTags(t *testing.T) {
+	native := Schema{SummaryKey: "summary", HashKey: "summary_hash", TagsKey: "tags", AddedTagsKey: "ai_tags"}
+
+	tests := []struct {
+		name            string
+		initialContent  string
+		tags            []string
+		expectedContent string
+	}{
+		{
+			name:            "Union with an existing list",
+			initialContent:  "---\ntags:\n  - Project\n  - inbox\n---\nBody",
+			tags:            []string{"project", "#Machine Learning", "2024"},
+			expectedContent: "---\ntags:\n  - Project\n  - inbox\n  - Machine-Learning\nsummary: \"Test summary\"\nsummary_hash: TestHash\nai_tags:\n  - Machine-Learning\n---\nBody",
+		},
+		{
+			name:            "Comma separated string keeps its form",
+			initialContent:  "---\ntags: a, b\n---\nBody",
+			tags:            []string{"B", "c/d"},
+			expectedContent: "---\ntags: a, b, c/d\nsummary: \"Test summary\"\nsummary_hash: TestHash\nai_tags:\n  - c/d\n---\nBody",
+		},
+		{
+			name:            "Tags of a previous run are replaced",
+			initialContent:  "---\ntags: [manual, old-ai]\nai_tags: [old-ai]\n---\nBody",
+			tags:            []string{"new ai"},
+			expectedContent: "---\ntags:\n  - manual\n  - new-ai\nai_tags:\n  - new-ai\nsummary: \"Test summary\"\nsummary_hash: TestHash\n---\nBody",
+		},
+		{
+			name:            "Nothing added removes the record",
+			initialContent:  "---\ntags: [manual, old-ai]\nai_tags: [old-ai]\n---\nBody",
+			tags:            []string{"Manual"},
+			expectedContent: "---\ntags:\n  - manual\nsummary: \"Test summary\"\nsummary_hash: TestHash\n---\nBody",
+		},
+		{
+			name:            "No frontmatter",
+			initialContent:  "Body",
+			tags:            []string{"a b"},
+			expectedContent: "---\nsummary: \"Test summary\"\nsummary_hash: TestHash\ntags:\n  - a-b\nai_tags:\n  - a-b\n---\nBody",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Update(tt.initialContent, "Test summary", tt.tags, "TestHash", WithSchema(native), MergeTags(true))
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if got != tt.expectedContent {
+				t.Errorf("Content mismatch.\nExpected:\n'%s'\nGot:\n'%s'", tt.expectedContent, got)
+			}
+		})
+	}
+
+	t.Run("Invalid YAML", func(t *testing.T) {
+		if _, err := Update("---\ntags: \"broken \"quotes\"\n---\n", "Test summary", nil, "TestHash", WithSchema(native), MergeTags(true)); err == nil {
+			t.Error("Expected error")
+		}
+	})
+}
+
+func TestSchemaValidate(t *testing.T) {
+	valid := []Schema{
+		DefaultSchema,
+		{SummaryKey: "description", HashKey: "ai.hash", TagsKey: "tags"},
+		{SummaryKey: "ai.summary", HashKey: "ai.hash"},
+	}
+	for _, s := range valid {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid: %v", s, err)
+		}
+	}
+
+	invalid := []Schema{
+		{HashKey: "hash"},
+		{SummaryKey: "summary"},
+		{SummaryKey: "ai", HashKey: "ai.hash"},
+		{SummaryKey: "summary", HashKey: "summary"},
+		{SummaryKey: "ai..summary", HashKey: "hash"},
+		{SummaryKey: "summary", HashKey: "hash", TagsKey: "tags", AddedTagsKey: "tags"},
+	}
+	for _, s := range invalid {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", s)
+		}
+	}
+}
+
+func TestHasSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		schema   Schema
+		expected bool
+	}{
+		{"No frontmatter", "summarize_ai: in body", DefaultSchema, false},
+		{"Summary present", "---\nsummarize_ai: x\n---\n", DefaultSchema, true},
+		{"Nested key with same name", "---\nmeta:\n  summarize_ai: x\n---\n", DefaultSchema, false},
+		{"Nested schema key", "---\nai:\n  summary: x\n---\n", Schema{SummaryKey: "ai.summary", HashKey: "ai.hash"}, true},
+		{"Invalid YAML", "---\nsummarize_ai: \"broken \"quotes\"\n---\n", DefaultSchema, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasSummary(tt.content, tt.schema); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadListAndBody(t *testing.T) {
+	content := "---\ntags: [a, b]\naliases: x, y\n---\nBody\n"
+	if got := ReadList(content, "tags"); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Unexpected tags: %v", got)
+	}
+	if got := ReadList(content, "aliases"); !reflect.DeepEqual(got, []string{"x", "y"}) {
+		t.Errorf("Unexpected aliases: %v", got)
+	}
+	if got := ReadList(content, "missing"); got != nil {
+		t.Errorf("Expected nil, got %v", got)
+	}
+	if got := Body(content); got != "Body\n" {
+		t.Errorf("Unexpected body: %q", got)
+	}
+	if got := Body("No frontmatter"); got != "No frontmatter" {
+		t.Errorf("Unexpected body: %q", got)
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	notes := []string{
+		"Body without frontmatter\n",
+		"---\ntitle: x\ntags: [a]\n---\nBody\n",
+		"---\r\ntitle: x\r\n---\r\nBody\r\n",
+		"---\nai:\n  other: y\n---\nBody\n",
+	}
+	nested := Schema{SummaryKey: "ai.summary", HashKey: "ai.hash", ContentHashKey: "ai.content", ModelKey: "ai.model"}
+
+	for _, schema := range []Schema{DefaultSchema, nested} {
+		for _, note := range notes {
+			hash := ContentHash(note, schema)
+			updated, err := Update(note, "Test summary", []string{"b"}, "TestHash", WithSchema(schema), WithContentHash(hash), WithModel("openai/gpt"))
+			if err != nil {
+				t.Fatalf("Update failed: %v", err)
+			}
+			if got := ContentHash(updated, schema); got != hash {
+				t.Errorf("Writing the summary changed the content hash of %q:\n%s", note, updated)
+			}
+
+			values, found, err := Read(updated, schema)
+			if err != nil || !found {
+				t.Fatalf("Read failed: found=%v, err=%v", found, err)
+			}
+			if values.ContentHash != hash || values.Model != "openai/gpt" {
+				t.Errorf("Unexpected values: %+v", values)
+			}
+
+			if edited := strings.Replace(updated, "Body", "Edited body", 1); ContentHash(edited, schema) == hash {
+				t.Errorf("Editing the body did not change the content hash of %q", note)
+			}
+		}
+	}
+
+	native := Schema{SummaryKey: "summary", HashKey: "hash", TagsKey: "tags", AddedTagsKey: "ai_tags"}
+	note := "---\ntags: a\n---\nBody"
+	merged, err := Update(note, "Test summary", []string{"b"}, "TestHash", WithSchema(native), MergeTags(true))
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if ContentHash(merged, native) != ContentHash(note, native) {
+		t.Error("Merging tags changed the content hash")
+	}
+	if ContentHash(note, native) == ContentHash(note, DefaultSchema) {
+		t.Error("Keys outside of the schema must be part of the content hash")
+	}
 }
@@ -0,0 +1,272 @@
+package frontmatter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	KeySummary = "summarize_ai"
+	KeyHash    = "summarize_ai_hash"
+	KeyTags    = "summarize_ai_tags"
+	// KeyAddedTags records the tags added by MergeTags
+	KeyAddedTags = "summarize_ai_added_tags"
+	// KeyContentHash records the hash of the note content the summary was created from
+	KeyContentHash = "summarize_ai_content_hash"
+	// KeyModel records the model which created the summary
+	KeyModel = "summarize_ai_model"
+)
+
+// Schema maps the generated values to frontmatter keys.
+// Nested keys are separated by dots, e.g. "ai.summary" is written as key summary of the map ai.
+type Schema struct {
+	SummaryKey string
+	HashKey    string
+	// TagsKey may be empty to not write tags at all, or "tags" to use Obsidian's native tags
+	TagsKey string
+	// AddedTagsKey records which tags of TagsKey were added by the AI when merging tags,
+	// so they can be replaced on the next run or removed by hand
+	AddedTagsKey string
+	// ContentHashKey and ModelKey may be empty to not record the content hash and the model
+	ContentHashKey string
+	ModelKey       string
+}
+
+// DefaultSchema uses the summarize_ai, summarize_ai_hash, summarize_ai_tags and related keys
+var DefaultSchema = Schema{
+	SummaryKey:     KeySummary,
+	HashKey:        KeyHash,
+	TagsKey:        KeyTags,
+	AddedTagsKey:   KeyAddedTags,
+	ContentHashKey: KeyContentHash,
+	ModelKey:       KeyModel,
+}
+
+// Validate checks that the keys are well-formed and do not overlap
+func (s Schema) Validate() error {
+	if s.SummaryKey == "" {
+		return fmt.Errorf("summary key must not be empty")
+	}
+	if s.HashKey == "" {
+		return fmt.Errorf("hash key must not be empty")
+	}
+
+	keys := s.keys()
+	for i, key := range keys {
+		for _, part := range splitKey(key) {
+			if strings.TrimSpace(part) == "" {
+				return fmt.Errorf("invalid key %q: empty path segment", key)
+			}
+		}
+		for _, other := range keys[i+1:] {
+			if key == other || strings.HasPrefix(other, key+".") || strings.HasPrefix(key, other+".") {
+				return fmt.Errorf("keys %q and %q overlap", key, other)
+			}
+		}
+	}
+	return nil
+}
+
+// keys returns all configured keys
+func (s Schema) keys() []string {
+	var keys []string
+	for _, key := range []string{s.SummaryKey, s.HashKey, s.TagsKey, s.AddedTagsKey, s.ContentHashKey, s.ModelKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func splitKey(key string) []string {
+	return strings.Split(key, ".")
+}
+
+// Values are the generated values stored in the frontmatter
+type Values struct {
+	Summary string
+	Tags    []string
+	Hash    string
+	// ContentHash and Model are empty for summaries written before they were recorded
+	ContentHash string
+	Model       string
+}
+
+// Read returns the values stored under the keys of schema. found reports whether
+// a summary exists. Frontmatter which is no valid YAML is reported as error.
+func Read(content string, schema Schema) (values Values, found bool, err error) {
+	front, _, hasFront, err := split(content)
+	if err != nil || !hasFront {
+		return Values{}, false, err
+	}
+
+	var data map[string]any
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &data); err != nil {
+		return Values{}, false, fmt.Errorf("failed to parse frontmatter: %w", err)
+	}
+
+	summary, found := lookup(data, schema.SummaryKey)
+	if !found {
+		return Values{}, false, nil
+	}
+	values.Summary = fmt.Sprint(summary)
+	values.Hash = lookupString(data, schema.HashKey)
+	values.ContentHash = lookupString(data, schema.ContentHashKey)
+	values.Model = lookupString(data, schema.ModelKey)
+	if schema.TagsKey != "" {
+		if tags, ok := lookup(data, schema.TagsKey); ok {
+			values.Tags = toStrings(tags)
+		}
+	}
+	return values, true, nil
+}
+
+// HasSummary reports whether content contains a summary under the summary key of schema.
+// For frontmatter which is no valid YAML the unindented lines are searched for the key.
+func HasSummary(content string, schema Schema) bool {
+	_, found, err := Read(content, schema)
+	if err == nil {
+		return found
+	}
+
+	front, _, _, _ := split(content)
+	spans := scanKeySpans(front)
+	return len(spans[schema.SummaryKey]) > 0
+}
+
+// ReadList returns the value of key as a list of strings, splitting a comma separated string.
+// Missing keys and frontmatter which is no valid YAML result in nil.
+func ReadList(content, key string) []string {
+	front, _, hasFront, err := split(content)
+	if err != nil || !hasFront {
+		return nil
+	}
+
+	var data map[string]any
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &data); err != nil {
+		return nil
+	}
+	value, _ := lookup(data, key)
+	return toStrings(value)
+}
+
+// Block returns the frontmatter block of content including its delimiters and the line ending
+// of the closing delimiter, empty if there is none. Block(content) + Body(content) == content.
+func Block(content string) string {
+	return strings.TrimSuffix(content, Body(content))
+}
+
+// Body returns content without the frontmatter block
+func Body(content string) string {
+	_, remainder, hasFront, err := split(content)
+	if err != nil || !hasFront {
+		return content
+	}
+	if _, body, found := strings.Cut(remainder, "\n"); found {
+		return body
+	}
+	return ""
+}
+
+// ContentHash returns the hash of the note without the keys of schema (first 16 hex chars of SHA256),
+// so writing a summary does not change it but every edit of the note does.
+// Formatting and key order of valid frontmatter are not part of the hash.
+func ContentHash(content string, schema Schema) string {
+	front, remainder, hasFront, err := split(content)
+	if err != nil || !hasFront {
+		return hashString(content)
+	}
+	body := Body(content)
+
+	var data map[string]any
+	if err := yaml.Unmarshal([]byte(strings.Join(front, "\n")), &data); err != nil {
+		// Hash frontmatter which is no valid YAML as it is
+		return hashString(strings.TrimSuffix(content, remainder) + body)
+	}
+	for _, key := range schema.keys() {
+		deletePath(data, splitKey(key))
+	}
+	if len(data) == 0 {
+		return hashString(body)
+	}
+	normalized, err := yaml.Marshal(data)
+	if err != nil {
+		return hashString(content)
+	}
+	return hashString("---\n" + string(normalized) + "---\n" + body)
+}
+
+func hashString(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// deletePath removes the key path from data, including mappings left empty by the removal
+func deletePath(data map[string]any, path []string) {
+	if len(path) == 1 {
+		delete(data, path[0])
+		return
+	}
+	child, ok := data[path[0]].(map[string]any)
+	if !ok {
+		return
+	}
+	deletePath(child, path[1:])
+	if len(child) == 0 {
+		delete(data, path[0])
+	}
+}
+
+// lookup returns the value at the dotted key path within data
+func lookup(data map[string]any, key string) (any, bool) {
+	var current any = data
+	for _, part := range splitKey(key) {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = m[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// lookupString returns the value at the dotted key path as string, empty if it is missing
+func lookupString(data map[string]any, key string) string {
+	if key == "" {
+		return ""
+	}
+	if value, ok := lookup(data, key); ok && value != nil {
+		return fmt.Sprint(value)
+	}
+	return ""
+}
+
+// toStrings converts a YAML list or a single (comma separated) string into a list of strings
+func toStrings(value any) []string {
+	var result []string
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			if item != nil {
+				result = append(result, fmt.Sprint(item))
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	case nil:
+	default:
+		result = append(result, fmt.Sprint(v))
+	}
+	return result
+}
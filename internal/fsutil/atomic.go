@@ -0,0 +1,66 @@
+package fsutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic replaces the content of filePath without ever leaving it truncated:
+// data is written to a temporary file in the same directory, synced to disk and renamed
+// over the original. The permissions of an existing file are kept, new files get 0644.
+// With preserveModTime the modification time of the original file is restored as well.
+func WriteFileAtomic(filePath string, data []byte, preserveModTime bool) (err error) {
+	// Write through symlinks instead of replacing them
+	if resolved, err := filepath.EvalSymlinks(filePath); err == nil {
+		filePath = resolved
+	}
+
+	mode := os.FileMode(0644)
+	info, statErr := os.Stat(filePath)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(statErr) {
+		return fmt.Errorf("failed to stat file: %w", statErr)
+	}
+
+	dir := filepath.Dir(filePath)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err = tmp.Chmod(mode); err != nil {
+		return fmt.Errorf("failed to set permissions: %w", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if preserveModTime && statErr == nil {
+		if err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+			return fmt.Errorf("failed to preserve modification time: %w", err)
+		}
+	}
+	if err = os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+
+	// Persist the rename itself, not supported on every platform
+	if d, dirErr := os.Open(dir); dirErr == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "note.md")
+	if err := os.WriteFile(filePath, []byte("Some content"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filePath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	if err := WriteFileAtomic(filePath, []byte("Updated"), true); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("File mode not preserved: expected 0600, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("Modification time not preserved: expected %v, got %v", modTime, info.ModTime())
+	}
+	if content, _ := os.ReadFile(filePath); string(content) != "Updated" {
+		t.Errorf("File not updated: %q", content)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+
+	// Without preserving, the modification time is updated
+	if err := WriteFileAtomic(filePath, []byte("Again"), false); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	info, err = os.Stat(filePath)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if info.ModTime().Equal(modTime) {
+		t.Errorf("Modification time unexpectedly preserved")
+	}
+}
+
+func TestWriteFileAtomicKeepsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.md")
+	link := filepath.Join(dir, "link.md")
+	if err := os.WriteFile(target, []byte("Some content"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("Updated"), false); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatalf("Failed to stat link: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Symlink was replaced by a regular file")
+	}
+	if content, _ := os.ReadFile(target); string(content) != "Updated" {
+		t.Errorf("Target not updated: %q", content)
+	}
+}
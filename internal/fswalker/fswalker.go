@@ -5,11 +5,17 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sink"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/state"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/tags"
 )
 
 var defaultIgnoreDirs = []string{
 	".git",
 	".obsidian",
+	state.Dir,
 }
 
 func shouldIgnoreDir(name string) bool {
@@ -27,9 +33,93 @@ type FileInfo struct {
 	CharacterCount int
 }
 
-// ReadFiles reads a single file or all Markdown files in a folder recursively
-func ReadFiles(path string, override bool) ([]FileInfo, error) {
+// Selector decides by the state of a note whether it is summarized
+type Selector func(e state.Entry) bool
+
+// All selects every note
+func All() Selector {
+	return func(state.Entry) bool { return true }
+}
+
+// MissingSummary selects notes without a summary
+func MissingSummary() Selector {
+	return func(e state.Entry) bool {
+		return e.Summary == nil
+	}
+}
+
+// Stale selects notes without a summary and notes whose content, prompt hash or model
+// changed since their summary was written, including summaries without a recorded content hash
+func Stale(promptHash, model string) Selector {
+	return func(e state.Entry) bool {
+		return e.Summary == nil ||
+			e.Summary.PromptHash != promptHash ||
+			e.Summary.Model != model ||
+			e.Summary.ContentHash != e.ContentHash
+	}
+}
+
+// Options configure ReadFiles
+type Options struct {
+	// Schema are the frontmatter keys the summary is read from
+	Schema frontmatter.Schema
+	// Selected decides which notes are returned, nil selects notes without a summary
+	Selected Selector
+	// Index receives the frontmatter tags and inline #tags of all notes, including unselected ones, if not nil
+	Index *tags.Index
+	// TagsKey is the frontmatter key of the tags of the user, "tags" if empty. The tags recorded
+	// under Schema.AddedTagsKey were added by the AI and are left out of the index.
+	TagsKey string
+	// State caches the entries of the notes of a folder by modification time and size, so unchanged
+	// notes are not read again. Paths are relative to the folder. Nil reads every note.
+	State *state.Store
+	// SummaryOf replaces the summary metadata read from the frontmatter if not nil, e.g. by the one
+	// of a sidecar. It receives the path relative to the folder, or the name of a single file.
+	SummaryOf func(path string) *state.Summary
+	// Exclude are files and directories written by this tool, e.g. a sidecar, which are skipped
+	// when walking a folder so previous summaries are not summarized
+	Exclude []string
+	// ExcludeSuffixes skips files whose name ends with one of the suffixes when walking a folder
+	ExcludeSuffixes []string
+	// Visited is called with the path relative to the folder of every note found, selected or not, if not nil
+	Visited func(path string)
+}
+
+// excluded reports whether a walked path is one of opts.Exclude or has one of opts.ExcludeSuffixes
+func (opts Options) excluded(path string, abs map[string]bool) bool {
+	for _, suffix := range opts.ExcludeSuffixes {
+		if strings.HasSuffix(filepath.Base(path), suffix) {
+			return true
+		}
+	}
+	if len(abs) == 0 {
+		return false
+	}
+	path, err := filepath.Abs(path)
+	return err == nil && abs[path]
+}
+
+// ReadFiles reads a single file or all Markdown files in a folder recursively and returns the ones selected
+func ReadFiles(path string, opts Options) ([]FileInfo, error) {
+	if opts.Selected == nil {
+		opts.Selected = MissingSummary()
+	}
+
 	var files []FileInfo
+	add := func(path, rel string, e state.Entry) {
+		if opts.SummaryOf != nil {
+			e.Summary = opts.SummaryOf(rel)
+		}
+		if opts.Index != nil {
+			opts.Index.Add(e.Tags...)
+		}
+		if opts.Selected(e) {
+			files = append(files, FileInfo{
+				Path:           path,
+				CharacterCount: int(e.Size),
+			})
+		}
+	}
 
 	info, err := os.Stat(path)
 	if err != nil {
@@ -37,54 +127,116 @@ func ReadFiles(path string, override bool) ([]FileInfo, error) {
 	}
 
 	if info.IsDir() {
-		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		root := path
+		seen := map[string]bool{}
+		exclude := map[string]bool{}
+		for _, p := range opts.Exclude {
+			if p, err := filepath.Abs(p); err == nil {
+				exclude[p] = true
+			}
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if info.IsDir() && shouldIgnoreDir(info.Name()) {
+			if info.IsDir() && (shouldIgnoreDir(info.Name()) || path != root && opts.excluded(path, exclude)) {
 				return filepath.SkipDir
 			}
-			if !info.IsDir() && strings.HasSuffix(info.Name(), ".md") {
-				content, err := os.ReadFile(path)
-				if err != nil {
-					return err
-				}
+			if info.IsDir() || !strings.HasSuffix(info.Name(), ".md") || info.Size() == 0 || opts.excluded(path, exclude) {
+				return nil
+			}
 
-				if len(content) == 0 {
-					return nil
-				}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			seen[rel] = true
+			if opts.Visited != nil {
+				opts.Visited(rel)
+			}
 
-				if !override && strings.Contains(string(content), "summarize_ai:") {
+			if opts.State != nil {
+				if e, ok := opts.State.Get(rel); ok && e.Matches(info.ModTime(), info.Size()) {
+					add(path, rel, e)
 					return nil
 				}
+			}
 
-				files = append(files, FileInfo{
-					Path:           path,
-					CharacterCount: len(content),
-				})
+			e, err := readEntry(path, info, opts)
+			if err != nil {
+				return err
+			}
+			if opts.State != nil {
+				opts.State.Put(rel, e)
 			}
+			add(path, rel, e)
 			return nil
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to walk directory: %w", err)
 		}
-	} else {
-		if strings.HasSuffix(info.Name(), ".md") {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return nil, fmt.Errorf("failed to read file: %w", err)
-			}
+		if opts.State != nil {
+			opts.State.Retain(func(path string) bool { return seen[path] })
+		}
+	} else if strings.HasSuffix(info.Name(), ".md") {
+		e, err := readEntry(path, info, opts)
+		if err != nil {
+			return nil, err
+		}
+		add(path, info.Name(), e)
+	}
 
-			if !override && strings.Contains(string(content), "summarize_ai:") {
-				return nil, nil
-			}
+	return files, nil
+}
 
-			files = append(files, FileInfo{
-				Path:           path,
-				CharacterCount: len(content),
-			})
+// readEntry reads a note and extracts the state needed to select it
+func readEntry(path string, info os.FileInfo, opts Options) (state.Entry, error) {
+	schema := opts.Schema
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return state.Entry{}, fmt.Errorf("failed to read file: %w", err)
+	}
+	// The summary callout is written by this tool and no content of the note
+	content, _ := sink.StripCallout(string(contentBytes))
+
+	e := state.Entry{
+		ModTime:     info.ModTime(),
+		Size:        int64(len(contentBytes)),
+		ContentHash: frontmatter.ContentHash(content, schema),
+		Tags:        append(userTags(content, opts), tags.Extract(frontmatter.Body(content))...),
+	}
+
+	values, found, err := frontmatter.Read(content, schema)
+	switch {
+	case found:
+		e.Summary = &state.Summary{PromptHash: values.Hash, Model: values.Model, ContentHash: values.ContentHash}
+	case err != nil && frontmatter.HasSummary(content, schema):
+		// A summary in frontmatter which is no valid YAML is always stale
+		e.Summary = &state.Summary{}
+	}
+	return e, nil
+}
+
+// userTags returns the frontmatter tags of a note without the ones added by the AI, so the
+// tag vocabulary is not taught the spellings of earlier summaries
+func userTags(content string, opts Options) []string {
+	key := opts.TagsKey
+	if key == "" {
+		key = "tags"
+	}
+	added := map[string]bool{}
+	if opts.Schema.AddedTagsKey != "" {
+		for _, tag := range frontmatter.ReadList(content, opts.Schema.AddedTagsKey) {
+			added[tags.Key(tag)] = true
 		}
 	}
 
-	return files, nil
+	var result []string
+	for _, tag := range frontmatter.ReadList(content, key) {
+		if !added[tags.Key(tag)] {
+			result = append(result, tag)
+		}
+	}
+	return result
 }
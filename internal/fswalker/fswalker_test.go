@@ -0,0 +1,208 @@
+package fswalker
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/state"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/tags"
+)
+
+func TestReadFilesExclude(t *testing.T) {
+	vault := t.TempDir()
+	for _, name := range []string{"a.md", "sub/b.md", "sums/a.md.summary.md", "notes.summary.md", "sums/other.md"} {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# Note\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := ReadFiles(vault, Options{
+		Selected:        All(),
+		Exclude:         []string{filepath.Join(vault, "sums")},
+		ExcludeSuffixes: []string{".summary.md"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(vault, f.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "a.md" || got[1] != "sub/b.md" {
+		t.Errorf("expected a.md and sub/b.md, got %v", got)
+	}
+}
+
+func TestReadFilesVisited(t *testing.T) {
+	vault := t.TempDir()
+	for _, name := range []string{"a.md", "sub/b.md", "a.summary.md"} {
+		path := filepath.Join(vault, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# Note\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	files, err := ReadFiles(vault, Options{
+		Selected:        func(state.Entry) bool { return false },
+		ExcludeSuffixes: []string{".summary.md"},
+		Visited:         func(path string) { got = append(got, path) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no selected notes, got %d", len(files))
+	}
+	sort.Strings(got)
+	if len(got) != 2 || got[0] != "a.md" || got[1] != "sub/b.md" {
+		t.Errorf("expected a.md and sub/b.md to be visited, got %v", got)
+	}
+}
+
+func TestReadFilesExcludeRelative(t *testing.T) {
+	vault := t.TempDir()
+	t.Chdir(vault)
+	for _, name := range []string{"a.md", "sums/a.md.summary.md"} {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte("# Note\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The sidecar given relative to the working directory is excluded from the vault walked as "."
+	files, err := ReadFiles(".", Options{Selected: All(), Exclude: []string{"sums"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Path != "a.md" {
+		t.Errorf("expected only a.md, got %v", files)
+	}
+}
+
+func TestReadFilesIndexSkipsAddedTags(t *testing.T) {
+	vault := t.TempDir()
+	note := "---\ntags: [project, ai-spelling]\nsummarize_ai_added_tags: [ai-spelling]\n---\nText #inline\n"
+	if err := os.WriteFile(filepath.Join(vault, "a.md"), []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	index := tags.NewIndex()
+	if _, err := ReadFiles(vault, Options{Schema: frontmatter.DefaultSchema, Index: index, TagsKey: "tags"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := index.Top(0); !reflect.DeepEqual(got, []string{"inline", "project"}) {
+		t.Errorf("expected only the tags of the user, got %v", got)
+	}
+}
+
+func TestStale(t *testing.T) {
+	selected := Stale("prompt", "openai/gpt-4o-mini")
+	tests := []struct {
+		name     string
+		entry    state.Entry
+		expected bool
+	}{
+		{"No summary", state.Entry{ContentHash: "c"}, true},
+		{"Up to date", state.Entry{ContentHash: "c", Summary: &state.Summary{PromptHash: "prompt", Model: "openai/gpt-4o-mini", ContentHash: "c"}}, false},
+		{"Prompt hash changed", state.Entry{ContentHash: "c", Summary: &state.Summary{PromptHash: "old", Model: "openai/gpt-4o-mini", ContentHash: "c"}}, true},
+		{"Model changed", state.Entry{ContentHash: "c", Summary: &state.Summary{PromptHash: "prompt", Model: "ollama/llama3.2", ContentHash: "c"}}, true},
+		{"Content changed", state.Entry{ContentHash: "new", Summary: &state.Summary{PromptHash: "prompt", Model: "openai/gpt-4o-mini", ContentHash: "c"}}, true},
+		{"Summary without content hash", state.Entry{ContentHash: "c", Summary: &state.Summary{PromptHash: "prompt", Model: "openai/gpt-4o-mini"}}, true},
+	}
+	for _, tt := range tests {
+		if got := selected(tt.entry); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestReadFilesSelection(t *testing.T) {
+	schema := frontmatter.DefaultSchema
+	vault := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(vault, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summarized := func(body, promptHash, model string) string {
+		hash := frontmatter.ContentHash("---\ntitle: x\n---\n"+body, schema)
+		return "---\ntitle: x\nsummarize_ai: Sum\nsummarize_ai_hash: " + promptHash +
+			"\nsummarize_ai_content_hash: " + hash + "\nsummarize_ai_model: " + model + "\n---\n" + body
+	}
+
+	write("new.md", "---\ntitle: x\n---\nBody\n")
+	write("current.md", summarized("Body\n", "prompt", "m"))
+	write("prompt.md", summarized("Body\n", "old", "m"))
+	write("model.md", summarized("Body\n", "prompt", "other"))
+	write("content.md", strings.Replace(summarized("Body\n", "prompt", "m"), "Body", "Edited", 1))
+	write("no-content-hash.md", "---\nsummarize_ai: Sum\nsummarize_ai_hash: prompt\nsummarize_ai_model: m\n---\nBody\n")
+	write("invalid.md", "---\nsummarize_ai: Sum\nsummarize_ai_hash: prompt\n  bad: [\n---\nBody\n")
+	write("sidecar.md", "---\ntitle: x\n---\nBody\n")
+
+	names := func(files []FileInfo) []string {
+		var result []string
+		for _, f := range files {
+			result = append(result, filepath.Base(f.Path))
+		}
+		sort.Strings(result)
+		return result
+	}
+
+	files, err := ReadFiles(vault, Options{Schema: schema, Selected: Stale("prompt", "m")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"content.md", "invalid.md", "model.md", "new.md", "no-content-hash.md", "prompt.md", "sidecar.md"}
+	if got := names(files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// The summary in invalid YAML is found, it only counts as stale
+	files, err = ReadFiles(vault, Options{Schema: schema})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(files); !reflect.DeepEqual(got, []string{"new.md", "sidecar.md"}) {
+		t.Errorf("expected only the notes without summary, got %v", got)
+	}
+
+	// A summary of the sidecar replaces the one of the frontmatter
+	sidecarHash := frontmatter.ContentHash("---\ntitle: x\n---\nBody\n", schema)
+	files, err = ReadFiles(vault, Options{
+		Schema:   schema,
+		Selected: Stale("prompt", "m"),
+		SummaryOf: func(path string) *state.Summary {
+			switch path {
+			case "sidecar.md":
+				return &state.Summary{PromptHash: "prompt", Model: "m", ContentHash: sidecarHash}
+			case "new.md", "current.md":
+				return nil
+			}
+			return &state.Summary{}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"content.md", "current.md", "invalid.md", "model.md", "new.md", "no-content-hash.md", "prompt.md"}
+	if got := names(files); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v with sidecar summaries, got %v", expected, got)
+	}
+}
@@ -0,0 +1,247 @@
+package journal
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+)
+
+const extension = ".jsonl"
+
+// ErrChanged is returned by Revert if the file was modified after the journaled write
+var ErrChanged = errors.New("file changed since it was summarized")
+
+// Entry records a single write of a note
+type Entry struct {
+	Run  string `json:"run"`
+	Path string `json:"path"`
+	// Offset is the byte offset of the changed lines. Before and After are the changed lines
+	// of the note before and after the write, typically the frontmatter block including
+	// its delimiters. Before is empty if lines were only added.
+	Offset int    `json:"offset,omitempty"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+	// Hash is the SHA256 of the whole note after the write
+	Hash string    `json:"hash"`
+	Time time.Time `json:"time"`
+}
+
+// Journal appends the writes of one run to <dir>/<run id>.jsonl. It is safe for concurrent use.
+type Journal struct {
+	id   string
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	entries int
+}
+
+// Create starts the journal of a new run in dir
+func Create(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to create run id: %w", err)
+	}
+	id := time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+
+	path := filepath.Join(dir, id+extension)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal: %w", err)
+	}
+	return &Journal{id: id, path: path, file: f}, nil
+}
+
+// ID returns the run id
+func (j *Journal) ID() string {
+	return j.id
+}
+
+// Record journals the change of the note at path from original to updated.
+// It returns only after the entry is synced to disk, so it has to be called before the write.
+func (j *Journal) Record(path string, original, updated []byte) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	offset, before, after := changedLines(string(original), string(updated))
+	line, err := json.Marshal(Entry{
+		Run:    j.id,
+		Path:   abs,
+		Offset: offset,
+		Before: before,
+		After:  after,
+		Hash:   hash(updated),
+		Time:   time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal: %w", err)
+	}
+	j.entries++
+	return nil
+}
+
+// Len returns the number of recorded entries
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.entries
+}
+
+// Close closes the journal, a journal without entries is removed
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("failed to close journal: %w", err)
+	}
+	if j.entries == 0 {
+		return os.Remove(j.path)
+	}
+	return nil
+}
+
+// Runs returns the ids of all journaled runs in dir, oldest first
+func Runs(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+	if err != nil {
+		return nil, err
+	}
+	var runs []string
+	for _, match := range matches {
+		runs = append(runs, strings.TrimSuffix(filepath.Base(match), extension))
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// Load returns the entries of a run
+func Load(dir, run string) ([]Entry, error) {
+	f, err := os.Open(filepath.Join(dir, filepath.Base(run)+extension))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal of run %s: %w", run, err)
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A run killed while writing leaves an incomplete last line
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal of run %s: %w", run, err)
+	}
+	return entries, nil
+}
+
+// Latest returns the most recent entry of all runs in dir whose write is the current content of
+// the note at path, i.e. the change which can be reverted next
+func Latest(dir, path string) (Entry, bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to resolve path: %w", err)
+	}
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("failed to read file: %w", err)
+	}
+	current := hash(content)
+
+	runs, err := Runs(dir)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		entries, err := Load(dir, runs[i])
+		if err != nil {
+			return Entry{}, false, err
+		}
+		for k := len(entries) - 1; k >= 0; k-- {
+			if entries[k].Path == abs && entries[k].Hash == current {
+				return entries[k], true, nil
+			}
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// Revert restores the frontmatter of the note before the write of e.
+// It refuses with ErrChanged if the note is no longer exactly as written.
+func Revert(e Entry) error {
+	content, err := os.ReadFile(e.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	end := e.Offset + len(e.After)
+	if hash(content) != e.Hash || end > len(content) || string(content[e.Offset:end]) != e.After {
+		return fmt.Errorf("%s: %w", e.Path, ErrChanged)
+	}
+	restored := string(content[:e.Offset]) + e.Before + string(content[end:])
+	return fsutil.WriteFileAtomic(e.Path, []byte(restored), false)
+}
+
+// changedLines returns the offset and the lines of original and updated between their common
+// leading and trailing lines, so an entry only holds the lines a write changed
+func changedLines(original, updated string) (offset int, before, after string) {
+	// Common prefix of whole lines
+	for offset < len(original) && offset < len(updated) {
+		end := strings.IndexByte(original[offset:], '\n')
+		if end < 0 {
+			break
+		}
+		line := original[offset : offset+end+1]
+		if !strings.HasPrefix(updated[offset:], line) {
+			break
+		}
+		offset += len(line)
+	}
+
+	// Common suffix of whole lines, not overlapping the prefix
+	origEnd, updEnd := len(original), len(updated)
+	for origEnd > offset && updEnd > offset {
+		start := strings.LastIndexByte(original[offset:origEnd-1], '\n') + 1 + offset
+		line := original[start:origEnd]
+		updStart := updEnd - len(line)
+		if updStart < offset || updated[updStart:updEnd] != line || updStart > offset && updated[updStart-1] != '\n' {
+			break
+		}
+		origEnd, updEnd = start, updStart
+	}
+	return offset, original[offset:origEnd], updated[offset:updEnd]
+}
+
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
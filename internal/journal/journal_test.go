@@ -0,0 +1,174 @@
+package journal
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+)
+
+// summarize writes a summary to the note at path, journaling the change in j
+func summarize(t *testing.T, j *Journal, path, summary string) {
+	t.Helper()
+	original, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := frontmatter.Update(string(original), summary, []string{"tag"}, "hash")
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := j.Record(path, original, []byte(updated)); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := fsutil.WriteFileAtomic(path, []byte(updated), false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRevertRun(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := filepath.Join(dir, "journal")
+	notes := map[string]string{
+		filepath.Join(dir, "plain.md"):  "No frontmatter\n",
+		filepath.Join(dir, "front.md"):  "---\r\ntitle: x # comment\r\n---\r\nBody\r\n",
+		filepath.Join(dir, "edited.md"): "---\ntitle: y\n---\nBody\n",
+	}
+	for path, content := range notes {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	j, err := Create(journalDir)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for path := range notes {
+		summarize(t, j, path, "Summary")
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	edited := filepath.Join(dir, "edited.md")
+	if err := os.WriteFile(edited, []byte(read(t, edited)+"edit\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := Runs(journalDir)
+	if err != nil || len(runs) != 1 || runs[0] != j.ID() {
+		t.Fatalf("expected run %s, got %v (%v)", j.ID(), runs, err)
+	}
+	entries, err := Load(journalDir, j.ID())
+	if err != nil || len(entries) != len(notes) {
+		t.Fatalf("expected %d entries, got %d (%v)", len(notes), len(entries), err)
+	}
+
+	for _, e := range entries {
+		err := Revert(e)
+		if e.Path == edited {
+			if !errors.Is(err, ErrChanged) {
+				t.Errorf("expected ErrChanged for the edited note, got %v", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Revert failed: %v", err)
+		}
+		if got := read(t, e.Path); got != notes[e.Path] {
+			t.Errorf("expected %q, got %q", notes[e.Path], got)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	dir := t.TempDir()
+	journalDir := filepath.Join(dir, "journal")
+	path := filepath.Join(dir, "note.md")
+	original := "---\ntitle: x\n---\nBody\n"
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var versions []string
+	for _, summary := range []string{"First", "Second"} {
+		j, err := Create(journalDir)
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+		summarize(t, j, path, summary)
+		j.Close()
+		versions = append(versions, read(t, path))
+	}
+
+	// Every revert steps back one run
+	for _, expected := range []string{versions[0], original} {
+		e, ok, err := Latest(journalDir, path)
+		if err != nil || !ok {
+			t.Fatalf("Latest failed: ok=%v, err=%v", ok, err)
+		}
+		if err := Revert(e); err != nil {
+			t.Fatalf("Revert failed: %v", err)
+		}
+		if got := read(t, path); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+
+	if _, ok, err := Latest(journalDir, path); err != nil || ok {
+		t.Errorf("expected nothing left to revert, got ok=%v, err=%v", ok, err)
+	}
+}
+
+func TestCloseRemovesEmptyJournal(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Create(dir)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if runs, _ := Runs(dir); len(runs) != 0 {
+		t.Errorf("expected no runs, got %v", runs)
+	}
+}
+
+func TestChangedLines(t *testing.T) {
+	tests := []struct {
+		name, original, updated string
+		offset                  int
+		before, after           string
+	}{
+		{"Frontmatter added", "Body\n", "---\nk: v\n---\nBody\n", 0, "", "---\nk: v\n---\n"},
+		{"Line replaced", "---\na: 1\nb: 2\n---\nBody", "---\na: 1\nb: 3\n---\nBody", 9, "b: 2\n", "b: 3\n"},
+		{"Line inserted into body", "---\n---\nBody\nEnd", "---\n---\n> callout\nBody\nEnd", 8, "", "> callout\n"},
+		{"Partial line", "a\nb\n", "a\nxb\n", 2, "b\n", "xb\n"},
+		{"Last line without newline", "a\nb", "a\nc", 2, "b", "c"},
+		{"Equal", "a\n", "a\n", 2, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offset, before, after := changedLines(tt.original, tt.updated)
+			if offset != tt.offset || before != tt.before || after != tt.after {
+				t.Errorf("expected %d %q %q, got %d %q %q", tt.offset, tt.before, tt.after, offset, before, after)
+			}
+			if restored := tt.updated[:offset] + before + tt.updated[offset+len(after):]; restored != tt.original {
+				t.Errorf("restoring gives %q", restored)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package preprocess
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fence"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+)
+
+// Step transforms the text of a note before it is sent to the model
+type Step func(text string) string
+
+// steps are the available steps by name
+var steps = map[string]Step{
+	"frontmatter":       removeFrontmatter,
+	"html-comments":     outsideCode(htmlCommentRegex, ""),
+	"obsidian-comments": outsideCode(obsidianCommentRegex, ""),
+	"dataview":          removeDataview,
+	"images":            removeImages,
+	"wikilinks":         resolveWikilinks,
+}
+
+// DefaultSteps remove everything which is not content of the note. Resolving wikilinks is optional.
+var DefaultSteps = []string{"frontmatter", "html-comments", "obsidian-comments", "dataview", "images"}
+
+var (
+	htmlCommentRegex     = regexp.MustCompile(`(?s)<!--.*?-->`)
+	obsidianCommentRegex = regexp.MustCompile(`(?s)%%.*?%%`)
+	inlineDataviewRegex  = regexp.MustCompile("`\\$?=[^`]*`")
+	imageEmbedRegex      = regexp.MustCompile(`(?i)!\[\[[^\]]+\.(png|jpe?g|gif|svg|webp|bmp|avif|heic|tiff?)(\|[^\]]*)?\]\]`)
+	markdownImageRegex   = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	// wikilinkRegex matches [[folder/target#heading|alias]] and embeds starting with !
+	wikilinkRegex  = regexp.MustCompile(`!?\[\[(?:[^\]|#]*/)?([^\]|#]*)(?:#([^\]|]*))?(?:\|([^\]]*))?\]\]`)
+	blankLineRegex = regexp.MustCompile(`\n(?:[ \t]*\r?\n){2,}`)
+)
+
+// Pipeline applies steps in order
+type Pipeline struct {
+	names []string
+	steps []Step
+}
+
+// Names returns the names of all available steps
+func Names() []string {
+	names := make([]string, 0, len(steps))
+	for name := range steps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the pipeline of the named steps, "none" or no names result in a pipeline changing nothing
+func New(names []string) (Pipeline, error) {
+	var p Pipeline
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "none" {
+			continue
+		}
+		step, ok := steps[name]
+		if !ok {
+			return Pipeline{}, fmt.Errorf("unknown preprocessing step %q, available: %s", name, strings.Join(Names(), ", "))
+		}
+		p.names = append(p.names, name)
+		p.steps = append(p.steps, step)
+	}
+	return p, nil
+}
+
+// Names returns the names of the steps of the pipeline
+func (p Pipeline) Names() []string {
+	return p.names
+}
+
+// Apply returns text after all steps. Runs of blank lines left by removed content are collapsed.
+func (p Pipeline) Apply(text string) string {
+	if len(p.steps) == 0 {
+		return text
+	}
+	for _, step := range p.steps {
+		text = step(text)
+	}
+	return strings.TrimSpace(outsideCode(blankLineRegex, "\n\n")(text)) + "\n"
+}
+
+func removeFrontmatter(text string) string {
+	return frontmatter.Body(text)
+}
+
+// removeDataview removes dataview and dataviewjs code blocks and inline queries
+func removeDataview(text string) string {
+	var b strings.Builder
+	for _, s := range segments(text) {
+		switch {
+		case s.code && (s.lang == "dataview" || s.lang == "dataviewjs"):
+		case s.code:
+			b.WriteString(s.text)
+		default:
+			b.WriteString(inlineDataviewRegex.ReplaceAllString(s.text, ""))
+		}
+	}
+	return b.String()
+}
+
+// resolveWikilinks replaces links by their alias, else by the name of the linked note or heading.
+// Embeds are kept.
+func resolveWikilinks(text string) string {
+	return outsideCodeFunc(text, func(s string) string {
+		return wikilinkRegex.ReplaceAllStringFunc(s, func(link string) string {
+			m := wikilinkRegex.FindStringSubmatch(link)
+			switch {
+			case strings.HasPrefix(link, "!"):
+				return link
+			case m[3] != "":
+				return m[3]
+			case m[1] == "":
+				return m[2]
+			default:
+				return m[1]
+			}
+		})
+	})
+}
+
+func removeImages(text string) string {
+	text = outsideCode(imageEmbedRegex, "")(text)
+	return outsideCode(markdownImageRegex, "")(text)
+}
+
+// outsideCode returns a step replacing the matches of re outside of code blocks with replacement
+func outsideCode(re *regexp.Regexp, replacement string) Step {
+	return func(text string) string {
+		return outsideCodeFunc(text, func(s string) string {
+			return re.ReplaceAllString(s, replacement)
+		})
+	}
+}
+
+// outsideCodeFunc applies fn to the text between code blocks
+func outsideCodeFunc(text string, fn func(string) string) string {
+	var b strings.Builder
+	for _, s := range segments(text) {
+		if s.code {
+			b.WriteString(s.text)
+		} else {
+			b.WriteString(fn(s.text))
+		}
+	}
+	return b.String()
+}
+
+// segment is a part of a note, either a fenced code block including its fences or the text between them
+type segment struct {
+	text string
+	code bool
+	// lang is the language of the code block
+	lang string
+}
+
+// segments splits text into code blocks and the text between them, an unclosed code block reaches to the end
+func segments(text string) []segment {
+	var parts []segment
+	start := 0
+	for _, b := range fence.Blocks(text) {
+		if b.Start > start {
+			parts = append(parts, segment{text: text[start:b.Start]})
+		}
+		parts = append(parts, segment{text: text[b.Start:b.End], code: true, lang: b.Lang})
+		start = b.End
+	}
+	if start < len(text) {
+		parts = append(parts, segment{text: text[start:]})
+	}
+	return parts
+}
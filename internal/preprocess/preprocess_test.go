@@ -0,0 +1,62 @@
+package preprocess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		step     string
+		input    string
+		expected string
+	}{
+		{"frontmatter", "---\nsummarize_ai: \"Old\"\n---\nBody\n", "Body\n"},
+		{"frontmatter", "Body\n", "Body\n"},
+		{"html-comments", "a <!-- hidden\nlines --> b\n```html\n<!-- kept -->\n```\n", "a  b\n```html\n<!-- kept -->\n```\n"},
+		{"obsidian-comments", "a %%hidden%% b\n%%\nblock\n%%\nc\n", "a  b\n\nc\n"},
+		{"dataview", "# Tasks\n```dataview\nTASK FROM \"x\"\n```\nDue `= this.due` and `$= dv.current()`\n```go\n`= kept`\n```\n", "# Tasks\nDue  and \n```go\n`= kept`\n```\n"},
+		{"images", "a ![[photo.PNG|200]] ![[note]] ![alt](img/x.jpg) [link](x.md)\n", "a  ![[note]]  [link](x.md)\n"},
+		{"wikilinks", "[[Note]], [[folder/Note#Part|alias]], [[Note#Part]][[#Heading]] ![[embed]]\n", "Note, alias, NoteHeading ![[embed]]\n"},
+		{"wikilinks", "```\n[[kept]]\n```\n", "```\n[[kept]]\n```\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.step, func(t *testing.T) {
+			if got := steps[tt.step](tt.input); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	note := "---\ntitle: x\n---\n# Title\n\n<!-- todo -->\n\n\n![[image.png]]\n\nText with [[Link|a link]].\n"
+
+	p, err := New(DefaultSteps)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got, expected := p.Apply(note), "# Title\n\nText with [[Link|a link]].\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	p, err = New(append(DefaultSteps, " Wikilinks"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got, expected := p.Apply(note), "# Title\n\nText with a link.\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if !reflect.DeepEqual(p.Names(), append(DefaultSteps, "wikilinks")) {
+		t.Errorf("unexpected names %v", p.Names())
+	}
+
+	p, err = New([]string{"none"})
+	if err != nil || p.Apply(note) != note {
+		t.Errorf("expected an empty pipeline to keep the note, got %v", err)
+	}
+
+	if _, err := New([]string{"unknown"}); err == nil {
+		t.Error("expected an error for an unknown step")
+	}
+}
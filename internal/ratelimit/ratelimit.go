@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CharsPerToken is the rough number of characters per token used for estimations
+const CharsPerToken = 4
+
+// EstimateTokens estimates the number of tokens of a text with the given number of characters
+func EstimateTokens(chars int) int {
+	return (chars + CharsPerToken - 1) / CharsPerToken
+}
+
+// bucket is a token bucket refilled continuously up to its capacity
+type bucket struct {
+	capacity float64
+	tokens   float64
+	rate     float64 // tokens per second
+	last     time.Time
+}
+
+func newBucket(perMinute int, now time.Time) *bucket {
+	return &bucket{
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		rate:     float64(perMinute) / 60,
+		last:     now,
+	}
+}
+
+// reserve takes n tokens from the bucket and returns how long the caller has to wait
+// until they are available. The balance may become negative, so later callers queue up
+// behind earlier ones.
+func (b *bucket) reserve(n float64, now time.Time) time.Duration {
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	// a single request larger than the budget of a whole minute would never fit,
+	// it is allowed as soon as the bucket is full
+	n = min(n, b.capacity)
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Limiter paces requests to stay within a requests-per-minute and a tokens-per-minute budget.
+// It is safe for concurrent use by multiple workers. A nil *Limiter does not limit.
+type Limiter struct {
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// New creates a Limiter for the given budgets, a value of 0 disables the respective limit.
+// It returns nil if both limits are disabled.
+func New(requestsPerMinute, tokensPerMinute int) *Limiter {
+	if requestsPerMinute <= 0 && tokensPerMinute <= 0 {
+		return nil
+	}
+	l := &Limiter{now: time.Now}
+	now := l.now()
+	if requestsPerMinute > 0 {
+		l.requests = newBucket(requestsPerMinute, now)
+	}
+	if tokensPerMinute > 0 {
+		l.tokens = newBucket(tokensPerMinute, now)
+	}
+	return l
+}
+
+// Wait blocks until a request with the given estimated number of tokens fits into the budget
+// or ctx is done, in which case ctx.Err() is returned
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	d := l.Reserve(tokens)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reserve books a request with the given estimated number of tokens and returns
+// how long the caller has to wait before sending it
+func (l *Limiter) Reserve(tokens int) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	if l.requests != nil {
+		wait = max(wait, l.requests.reserve(1, now))
+	}
+	if l.tokens != nil {
+		wait = max(wait, l.tokens.reserve(float64(tokens), now))
+	}
+	return wait
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(rpm, tpm int, now *time.Time) *Limiter {
+	l := New(rpm, tpm)
+	l.now = func() time.Time { return *now }
+	if l.requests != nil {
+		l.requests.last = *now
+	}
+	if l.tokens != nil {
+		l.tokens.last = *now
+	}
+	return l
+}
+
+func TestLimiterRequestsPerMinute(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(60, 0, &now)
+
+	// the full budget is available immediately
+	for i := 0; i < 60; i++ {
+		if d := l.Reserve(100); d != 0 {
+			t.Fatalf("request %d: expected no wait, got %v", i, d)
+		}
+	}
+
+	// then one request per second
+	if d := l.Reserve(100); d != time.Second {
+		t.Errorf("expected 1s wait, got %v", d)
+	}
+	if d := l.Reserve(100); d != 2*time.Second {
+		t.Errorf("expected 2s wait for queued request, got %v", d)
+	}
+
+	now = now.Add(10 * time.Second)
+	if d := l.Reserve(100); d != 0 {
+		t.Errorf("expected no wait after refill, got %v", d)
+	}
+}
+
+func TestLimiterTokensPerMinute(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newTestLimiter(0, 6000, &now)
+
+	if d := l.Reserve(6000); d != 0 {
+		t.Fatalf("expected no wait, got %v", d)
+	}
+	// 100 tokens per second
+	if d := l.Reserve(500); d != 5*time.Second {
+		t.Errorf("expected 5s wait, got %v", d)
+	}
+
+	// a request larger than the whole budget waits for a full bucket only
+	now = now.Add(5 * time.Second)
+	if d := l.Reserve(100_000); d != time.Minute {
+		t.Errorf("expected 1m wait, got %v", d)
+	}
+}
+
+func TestNilLimiter(t *testing.T) {
+	l := New(0, 0)
+	if l != nil {
+		t.Fatal("expected nil limiter when all limits are disabled")
+	}
+	if d := l.Reserve(1000); d != 0 {
+		t.Errorf("expected no wait, got %v", d)
+	}
+	if err := l.Wait(context.Background(), 1000); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLimiterWaitCancelled(t *testing.T) {
+	l := New(1, 0)
+	if err := l.Wait(context.Background(), 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, 0); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	for chars, expected := range map[int]int{0: 0, 1: 1, 4: 1, 5: 2, 4000: 1000} {
+		if got := EstimateTokens(chars); got != expected {
+			t.Errorf("EstimateTokens(%d) = %d, expected %d", chars, got, expected)
+		}
+	}
+}
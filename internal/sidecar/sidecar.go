@@ -0,0 +1,252 @@
+package sidecar
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the file layout of a sidecar store
+type Format int
+
+const (
+	// JSON is a single JSON object keyed by path, written when the store is closed
+	JSON Format = iota
+	// JSONL appends a line per record, the last record of a path wins
+	JSONL
+	// Markdown writes a <path>.summary.md file per note into a directory
+	Markdown
+)
+
+// MarkdownSuffix is appended to the vault relative path of a note in a Markdown store
+const MarkdownSuffix = ".summary.md"
+
+// FormatOf derives the format from the path: .json and .jsonl files, anything else is a directory
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".jsonl":
+		return JSONL
+	default:
+		return Markdown
+	}
+}
+
+// Record is the summary of a note with the same metadata as stored in the frontmatter
+type Record struct {
+	// Path is the vault relative, slash separated path of the note
+	Path        string    `json:"path" yaml:"path"`
+	Summary     string    `json:"summary" yaml:"-"`
+	Tags        []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	PromptHash  string    `json:"prompt_hash" yaml:"prompt_hash"`
+	ContentHash string    `json:"content_hash,omitempty" yaml:"content_hash,omitempty"`
+	Model       string    `json:"model,omitempty" yaml:"model,omitempty"`
+	Updated     time.Time `json:"updated" yaml:"updated"`
+}
+
+// Store keeps the summaries of a vault outside of the notes. It is safe for concurrent use.
+type Store struct {
+	path   string
+	format Format
+
+	mu      sync.Mutex
+	records map[string]Record
+	jsonl   *os.File
+	// dirty is set by Put until a JSON store is written
+	dirty bool
+}
+
+// Open loads the store at path in the format derived by FormatOf, a missing store is created on the first write
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, format: FormatOf(path), records: map[string]Record{}}
+
+	var err error
+	switch s.format {
+	case JSON:
+		err = s.loadJSON()
+	case JSONL:
+		err = s.loadJSONL()
+	case Markdown:
+		err = s.loadMarkdown()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sidecar %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Get returns the record of the note at the vault relative path
+func (s *Store) Get(path string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[filepath.ToSlash(path)]
+	return r, ok
+}
+
+// Put stores a record. JSONL and Markdown stores write it immediately, JSON stores on Close.
+func (s *Store) Put(r Record) error {
+	r.Path = filepath.ToSlash(r.Path)
+	if r.Updated.IsZero() {
+		r.Updated = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.format {
+	case JSONL:
+		line, err := json.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode record: %w", err)
+		}
+		if s.jsonl == nil {
+			if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+				return fmt.Errorf("failed to create sidecar directory: %w", err)
+			}
+			if s.jsonl, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+				return fmt.Errorf("failed to open sidecar: %w", err)
+			}
+		}
+		if _, err := s.jsonl.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write sidecar: %w", err)
+		}
+	case Markdown:
+		data, err := markdown(r)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(s.path, filepath.FromSlash(r.Path)+MarkdownSuffix)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create sidecar directory: %w", err)
+		}
+		if err := fsutil.WriteFileAtomic(target, data, false); err != nil {
+			return err
+		}
+	}
+	s.records[r.Path] = r
+	s.dirty = true
+	return nil
+}
+
+// Close writes a JSON store if a record was put and closes the file of a JSONL store
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.format {
+	case JSON:
+		if !s.dirty {
+			return nil
+		}
+		data, err := json.MarshalIndent(s.records, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode sidecar: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+			return fmt.Errorf("failed to create sidecar directory: %w", err)
+		}
+		if err := fsutil.WriteFileAtomic(s.path, append(data, '\n'), false); err != nil {
+			return err
+		}
+		s.dirty = false
+	case JSONL:
+		if s.jsonl != nil {
+			return s.jsonl.Close()
+		}
+	}
+	return nil
+}
+
+func (s *Store) loadJSON() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.records)
+}
+
+func (s *Store) loadJSONL() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for scanner.Scan() {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A run killed while writing leaves an incomplete last line
+			continue
+		}
+		s.records[r.Path] = r
+	}
+	return scanner.Err()
+}
+
+func (s *Store) loadMarkdown() error {
+	err := filepath.WalkDir(s.path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, MarkdownSuffix) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		r, err := parseMarkdown(string(content))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		s.records[r.Path] = r
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// markdown renders a record as note with the metadata as frontmatter and the summary as body
+func markdown(r Record) ([]byte, error) {
+	var front strings.Builder
+	enc := yaml.NewEncoder(&front)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode record: %w", err)
+	}
+	return []byte("---\n" + front.String() + "---\n" + r.Summary + "\n"), nil
+}
+
+func parseMarkdown(content string) (Record, error) {
+	var r Record
+	front := strings.TrimSuffix(strings.TrimPrefix(frontmatter.Block(content), "---\n"), "---\n")
+	if err := yaml.Unmarshal([]byte(front), &r); err != nil {
+		return Record{}, fmt.Errorf("failed to parse sidecar: %w", err)
+	}
+	r.Summary = strings.TrimSuffix(frontmatter.Body(content), "\n")
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package sidecar
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]Format{
+		"summaries.json":  JSON,
+		"summaries.JSONL": JSONL,
+		"summaries":       Markdown,
+		"out/":            Markdown,
+	}
+	for path, expected := range tests {
+		if got := FormatOf(path); got != expected {
+			t.Errorf("FormatOf(%q) = %v, expected %v", path, got, expected)
+		}
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	updated := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	records := []Record{
+		{Path: "a.md", Summary: "First summary", Tags: []string{"x"}, PromptHash: "p", ContentHash: "c", Model: "openai/gpt", Updated: updated},
+		{Path: "notes/b.md", Summary: "Multi\nline: summary", PromptHash: "p", Updated: updated},
+		{Path: "a.md", Summary: "Replaced summary", PromptHash: "p2", Updated: updated},
+	}
+
+	for _, name := range []string{"summaries.json", "summaries.jsonl", "summaries"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			s, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			for _, r := range records {
+				if err := s.Put(r); err != nil {
+					t.Fatalf("Put failed: %v", err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+
+			loaded, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer loaded.Close()
+			for _, expected := range records[1:] {
+				got, ok := loaded.Get(expected.Path)
+				if !ok {
+					t.Fatalf("record %s not found", expected.Path)
+				}
+				got.Updated = got.Updated.UTC()
+				if !reflect.DeepEqual(got, expected) {
+					t.Errorf("expected %+v, got %+v", expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestCloseWithoutPut(t *testing.T) {
+	for _, name := range []string{"summaries.json", "summaries.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			s, err := Open(path)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("expected no sidecar to be written, got %v", err)
+			}
+		})
+	}
+
+	// An existing store is not rewritten if nothing was put
+	path := filepath.Join(t.TempDir(), "summaries.json")
+	if err := os.WriteFile(path, []byte(`{"a.md": {"path": "a.md", "summary": "x", "prompt_hash": "p"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != `{"a.md": {"path": "a.md", "summary": "x", "prompt_hash": "p"}}` {
+		t.Errorf("expected the sidecar to be unchanged, got %s", content)
+	}
+}
+
+func TestMarkdownLayout(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if err := s.Put(Record{Path: "notes/b.md", Summary: "Summary", PromptHash: "p"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "notes", "b.md.summary.md"))
+	if err != nil {
+		t.Fatalf("sidecar note not written: %v", err)
+	}
+	if got := string(content); got[:4] != "---\n" || got[len(got)-len("---\nSummary\n"):] != "---\nSummary\n" {
+		t.Errorf("unexpected sidecar note:\n%s", got)
+	}
+}
@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"strings"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+)
+
+const (
+	// CalloutStart and CalloutEnd delimit the summary callout. They are Obsidian comments,
+	// hidden in reading view, so the callout is found and replaced in place on every run.
+	CalloutStart = "%% summarize_ai:start %%"
+	CalloutEnd   = "%% summarize_ai:end %%"
+
+	// calloutHeader starts the summary callout
+	calloutHeader = "> [!summary]"
+)
+
+// Callout writes the summary as `> [!summary]` callout between CalloutStart and CalloutEnd.
+// An existing callout is replaced in place, otherwise it is inserted at the top of the body,
+// below the frontmatter. The rest of the note stays byte-for-byte.
+func Callout() Transform {
+	return func(content string, r Result) (string, error) {
+		eol := "\n"
+		if strings.Contains(content, "\r\n") {
+			eol = "\r\n"
+		}
+
+		block := frontmatter.Block(content)
+		body := strings.TrimPrefix(content, block)
+		if block != "" && !strings.HasSuffix(block, "\n") {
+			block += eol
+		}
+
+		start, end, found := calloutSpan(body)
+		if !found {
+			start, end = 0, 0
+		}
+
+		callout := CalloutStart + eol + calloutHeader + eol
+		for _, line := range strings.Split(strings.TrimSpace(r.Summary), "\n") {
+			callout += strings.TrimRight("> "+strings.TrimSuffix(line, "\r"), " ") + eol
+		}
+		callout += CalloutEnd + eol
+		if body[end:] != "" {
+			callout += eol
+		}
+		return block + body[:start] + callout + body[end:], nil
+	}
+}
+
+// StripCallout returns content without the summary callout and the blank line following it,
+// removed is false if the note has none
+func StripCallout(content string) (stripped string, removed bool) {
+	block := frontmatter.Block(content)
+	body := strings.TrimPrefix(content, block)
+	start, end, found := calloutSpan(body)
+	if !found {
+		return content, false
+	}
+	return block + body[:start] + body[end:], true
+}
+
+// calloutSpan returns the byte range of the summary callout in body, from CalloutStart to
+// CalloutEnd including the blank line following it. Summary callouts without the markers
+// are written by the user and never matched.
+func calloutSpan(body string) (start, end int, found bool) {
+	start = -1
+	for offset := 0; offset < len(body); {
+		line, next := lineAt(body, offset)
+		switch strings.TrimSpace(line) {
+		case CalloutStart:
+			start = offset
+		case CalloutEnd:
+			if start >= 0 {
+				return start, skipBlankLine(body, next), true
+			}
+		}
+		offset = next
+	}
+	return 0, 0, false
+}
+
+// lineAt returns the line starting at offset without its line ending and the offset of the next line
+func lineAt(s string, offset int) (string, int) {
+	i := strings.IndexByte(s[offset:], '\n')
+	if i < 0 {
+		return strings.TrimSuffix(s[offset:], "\r"), len(s)
+	}
+	return strings.TrimSuffix(s[offset:offset+i], "\r"), offset + i + 1
+}
+
+// skipBlankLine returns the offset after the line at offset if it is blank
+func skipBlankLine(s string, offset int) int {
+	if offset >= len(s) {
+		return offset
+	}
+	if line, next := lineAt(s, offset); strings.TrimSpace(line) == "" {
+		return next
+	}
+	return offset
+}
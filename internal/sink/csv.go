@@ -0,0 +1,114 @@
+package sink
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+)
+
+// csvHeader are the columns of a CSV export, tags are separated by commas
+var csvHeader = []string{"path", "summary", "tags", "prompt_hash", "content_hash", "model", "updated"}
+
+// CSV exports results to a CSV file with a row per note, sorted by path. The rows of an
+// existing file are kept and the ones of summarized notes replaced. It is safe for concurrent use.
+type CSV struct {
+	path string
+
+	mu    sync.Mutex
+	rows  map[string][]string
+	dirty bool
+}
+
+// OpenCSV loads the CSV file at path, a missing file is created on the Close after the first Write
+func OpenCSV(path string) (*CSV, error) {
+	c := &CSV{path: path, rows: map[string][]string{}}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV %s: %w", path, err)
+	}
+	defer f.Close()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV %s: %w", path, err)
+	}
+	if len(records) > 0 && strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		return nil, fmt.Errorf("CSV %s has unexpected columns %v, expected %v", path, records[0], csvHeader)
+	}
+	for _, row := range records[min(1, len(records)):] {
+		c.rows[row[0]] = row
+	}
+	return c, nil
+}
+
+// Get returns the result of the note at the vault relative path
+func (c *CSV) Get(path string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row, ok := c.rows[filepath.ToSlash(path)]
+	if !ok {
+		return Result{}, false
+	}
+	r := Result{RelPath: row[0], Summary: row[1], PromptHash: row[3], ContentHash: row[4], Model: row[5]}
+	if row[2] != "" {
+		r.Tags = strings.Split(row[2], ",")
+	}
+	return r, true
+}
+
+// Write stores the row of r, the file is written on Close
+func (c *CSV) Write(r Result) error {
+	path := filepath.ToSlash(r.RelPath)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rows[path] = []string{path, r.Summary, strings.Join(r.Tags, ","), r.PromptHash, r.ContentHash, r.Model, time.Now().Format(time.RFC3339)}
+	c.dirty = true
+	return nil
+}
+
+// Close writes all rows to the file, unless nothing was written
+func (c *CSV) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	paths := make([]string, 0, len(c.rows))
+	for path := range c.rows {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	w.Write(csvHeader)
+	for _, path := range paths {
+		w.Write(c.rows[path])
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to encode CSV: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create CSV directory: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(c.path, []byte(b.String()), false); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
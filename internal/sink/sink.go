@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/sidecar"
+)
+
+// Result is the summary of a note together with the metadata needed to tell whether it is stale
+type Result struct {
+	// Path is the path of the note as given to the summarizer
+	Path string
+	// RelPath is the vault relative, slash separated path of the note
+	RelPath     string
+	Summary     string
+	Tags        []string
+	PromptHash  string
+	ContentHash string
+	Model       string
+}
+
+// Sink is a destination of summaries. Write is called concurrently for different notes.
+type Sink interface {
+	Write(r Result) error
+	Close() error
+}
+
+// Multi writes every result to all sinks in order. It stops at the first failing sink, so a
+// sidecar listed after the note never records a summary the note is missing.
+type Multi []Sink
+
+// Write writes r to the sinks until one fails and returns its error
+func (m Multi) Write(r Result) error {
+	for _, s := range m {
+		if err := s.Write(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all sinks and returns their joined errors
+func (m Multi) Close() error {
+	var errs []error
+	for _, s := range m {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Transform returns content with the result written into it
+type Transform func(content string, r Result) (string, error)
+
+// Frontmatter writes the summary, hashes, model and tags into the frontmatter (see frontmatter.Update)
+func Frontmatter(opts ...frontmatter.Option) Transform {
+	return func(content string, r Result) (string, error) {
+		opts := append(opts[:len(opts):len(opts)], frontmatter.WithContentHash(r.ContentHash), frontmatter.WithModel(r.Model))
+		return frontmatter.Update(content, r.Summary, r.Tags, r.PromptHash, opts...)
+	}
+}
+
+// Note writes results into the notes themselves. All transforms are applied
+// to the content first, so a note is replaced once per result.
+type Note struct {
+	Transforms      []Transform
+	PreserveModTime bool
+	// BeforeWrite is called with the original and the updated content before the note is replaced,
+	// e.g. to journal the change. An error aborts the write.
+	BeforeWrite func(path string, original, updated []byte) error
+}
+
+// Render returns the current and the updated content of the note of r without writing it
+func (n *Note) Render(r Result) (original, updated string, err error) {
+	content, err := os.ReadFile(r.Path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file: %w", err)
+	}
+	updated = string(content)
+	for _, transform := range n.Transforms {
+		if updated, err = transform(updated, r); err != nil {
+			return "", "", err
+		}
+	}
+	return string(content), updated, nil
+}
+
+// Write replaces the note of r atomically, unchanged notes are not written
+func (n *Note) Write(r Result) error {
+	original, updated, err := n.Render(r)
+	if err != nil || original == updated {
+		return err
+	}
+	if n.BeforeWrite != nil {
+		if err := n.BeforeWrite(r.Path, []byte(original), []byte(updated)); err != nil {
+			return err
+		}
+	}
+	return fsutil.WriteFileAtomic(r.Path, []byte(updated), n.PreserveModTime)
+}
+
+// Close does nothing, notes are written immediately
+func (n *Note) Close() error {
+	return nil
+}
+
+type sidecarSink struct {
+	store *sidecar.Store
+}
+
+// Sidecar writes results to a sidecar store and closes it on Close
+func Sidecar(store *sidecar.Store) Sink {
+	return sidecarSink{store: store}
+}
+
+func (s sidecarSink) Write(r Result) error {
+	return s.store.Put(sidecar.Record{
+		Path:        r.RelPath,
+		Summary:     r.Summary,
+		Tags:        r.Tags,
+		PromptHash:  r.PromptHash,
+		ContentHash: r.ContentHash,
+		Model:       r.Model,
+	})
+}
+
+func (s sidecarSink) Close() error {
+	return s.store.Close()
+}
@@ -0,0 +1,214 @@
+package sink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+)
+
+const (
+	start = CalloutStart + "\n"
+	end   = CalloutEnd + "\n"
+)
+
+func TestCallout(t *testing.T) {
+	tests := []struct {
+		name, content, expected string
+	}{
+		{"Empty note", "", start + "> [!summary]\n> Sum\n" + end},
+		{"Body only", "Body\n", start + "> [!summary]\n> Sum\n" + end + "\nBody\n"},
+		{"Below frontmatter", "---\nk: v\n---\nBody\n", "---\nk: v\n---\n" + start + "> [!summary]\n> Sum\n" + end + "\nBody\n"},
+		{"Frontmatter without body", "---\nk: v\n---", "---\nk: v\n---\n" + start + "> [!summary]\n> Sum\n" + end},
+		{"Replaces callout in place", "# Title\n\n" + start + "> [!summary]\n> Old\n> lines\n" + end + "\nBody\n", "# Title\n\n" + start + "> [!summary]\n> Sum\n" + end + "\nBody\n"},
+		{"Keeps summary callout without markers", "---\nk: v\n---\n> [!summary] My own TL;DR\n> handwritten by me\n\nBody\n", "---\nk: v\n---\n" + start + "> [!summary]\n> Sum\n" + end + "\n> [!summary] My own TL;DR\n> handwritten by me\n\nBody\n"},
+		{"Keeps other callouts", "> [!note]\n> Mine\n\nBody\n", start + "> [!summary]\n> Sum\n" + end + "\n> [!note]\n> Mine\n\nBody\n"},
+		{"Ignores unterminated marker", start + "Body\n", start + "> [!summary]\n> Sum\n" + end + "\n" + start + "Body\n"},
+		{"CRLF", "---\r\nk: v\r\n---\r\nBody\r\n", "---\r\nk: v\r\n---\r\n" + CalloutStart + "\r\n> [!summary]\r\n> Sum\r\n" + CalloutEnd + "\r\n\r\nBody\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Callout()(tt.content, Result{Summary: "Sum"})
+			if err != nil {
+				t.Fatalf("Callout failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if again, _ := Callout()(got, Result{Summary: "Sum"}); again != got {
+				t.Errorf("rerun changed the note to %q", again)
+			}
+		})
+	}
+
+	got, _ := Callout()("Body\n", Result{Summary: "First\n\nSecond"})
+	if expected := start + "> [!summary]\n> First\n>\n> Second\n" + end + "\nBody\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestStripCallout(t *testing.T) {
+	notes := []string{
+		"",
+		"Body\n",
+		"---\nk: v\n---\nBody\n",
+		"---\nk: v\n---",
+		"# Title\n\nBody\n> quote\n",
+		"---\r\nk: v\r\n---\r\nBody\r\n",
+		"> [!summary] My own TL;DR\n> handwritten by me\n\nBody\n",
+	}
+	for _, note := range notes {
+		if stripped, removed := StripCallout(note); removed || stripped != note {
+			t.Errorf("expected %q to be unchanged, got %q", note, stripped)
+		}
+		withCallout, _ := Callout()(note, Result{Summary: "Sum"})
+		stripped, removed := StripCallout(withCallout)
+		expected := note
+		if note == "---\nk: v\n---" {
+			expected += "\n"
+		}
+		if !removed || stripped != expected {
+			t.Errorf("expected %q, got %q (removed %v)", expected, stripped, removed)
+		}
+	}
+}
+
+func TestNote(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "note.md")
+	if err := os.WriteFile(path, []byte("---\ntitle: x\n---\nBody\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var journaled int
+	note := &Note{
+		Transforms: []Transform{Frontmatter(frontmatter.WithSchema(frontmatter.DefaultSchema)), Callout()},
+		BeforeWrite: func(p string, original, updated []byte) error {
+			journaled++
+			return nil
+		},
+	}
+	r := Result{Path: path, Summary: "Sum", Tags: []string{"t"}, PromptHash: "p", ContentHash: "c", Model: "m"}
+	for i := 0; i < 2; i++ {
+		if err := note.Write(r); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if journaled != 1 {
+		t.Errorf("expected unchanged notes not to be written again, journaled %d writes", journaled)
+	}
+
+	content, _ := os.ReadFile(path)
+	values, found, err := frontmatter.Read(string(content), frontmatter.DefaultSchema)
+	if err != nil || !found || values.Summary != "Sum" || values.ContentHash != "c" || values.Model != "m" {
+		t.Errorf("unexpected frontmatter values %+v (found %v, %v)", values, found, err)
+	}
+	if body := frontmatter.Body(string(content)); body != start+"> [!summary]\n> Sum\n"+end+"\nBody\n" {
+		t.Errorf("unexpected body %q", body)
+	}
+
+	note.BeforeWrite = func(string, []byte, []byte) error { return errors.New("journal failed") }
+	if err := note.Write(Result{Path: path, Summary: "Other"}); err == nil {
+		t.Error("expected the write to be aborted")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(content) {
+		t.Error("note was written despite the failing BeforeWrite")
+	}
+}
+
+type failingSink struct{ closed *bool }
+
+func (f failingSink) Write(Result) error { return errors.New("failed") }
+func (f failingSink) Close() error       { *f.closed = true; return nil }
+
+func TestMulti(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	c, err := OpenCSV(path)
+	if err != nil {
+		t.Fatalf("OpenCSV failed: %v", err)
+	}
+	var closed bool
+	m := Multi{failingSink{&closed}, c}
+
+	if err := m.Write(Result{RelPath: "a.md", Summary: "Sum"}); err == nil {
+		t.Error("expected the error of the failing sink")
+	}
+	if _, ok := c.Get("a.md"); ok {
+		t.Error("expected the CSV not to record a summary a previous sink failed to write")
+	}
+	if err := m.Close(); err != nil || !closed {
+		t.Errorf("expected all sinks to be closed, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no CSV to be written, got %v", err)
+	}
+
+	// A note which cannot be written keeps the result from the sinks after it
+	c, err = OpenCSV(path)
+	if err != nil {
+		t.Fatalf("OpenCSV failed: %v", err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing.md")
+	m = Multi{&Note{Transforms: []Transform{Callout()}}, c}
+	if err := m.Write(Result{Path: missing, RelPath: "missing.md", Summary: "Sum"}); err == nil {
+		t.Error("expected the error of the note")
+	}
+	if _, ok := c.Get("missing.md"); ok {
+		t.Error("expected the CSV not to record the failed note")
+	}
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "export", "summaries.csv")
+	results := []Result{
+		{RelPath: "b.md", Summary: "Quoted \"summary\",\nmultiline", Tags: []string{"x", "y"}, PromptHash: "p", ContentHash: "c", Model: "m"},
+		{RelPath: "a.md", Summary: "First", PromptHash: "p"},
+	}
+
+	c, err := OpenCSV(path)
+	if err != nil {
+		t.Fatalf("OpenCSV failed: %v", err)
+	}
+	for _, r := range results {
+		if err := c.Write(r); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	loaded, err := OpenCSV(path)
+	if err != nil {
+		t.Fatalf("OpenCSV failed: %v", err)
+	}
+	for _, expected := range results {
+		got, ok := loaded.Get(expected.RelPath)
+		if !ok || !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %+v, got %+v (found %v)", expected, got, ok)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCSV(path); err == nil {
+		t.Error("expected an error for a CSV with other columns")
+	}
+}
+
+func TestCSVCloseWithoutWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "summaries.csv")
+	c, err := OpenCSV(path)
+	if err != nil {
+		t.Fatalf("OpenCSV failed: %v", err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected no CSV to be written, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fsutil"
+)
+
+const (
+	// Dir is the directory within the vault holding the state of this tool
+	Dir = ".obsidian-ai-sum"
+	// FileName is the name of the state file within Dir
+	FileName = "state.json"
+
+	// version is increased whenever the cached entries are derived differently
+	version = 2
+)
+
+// Entry is what is known about a note as of its modification time and size
+type Entry struct {
+	ModTime time.Time `json:"mtime"`
+	Size    int64     `json:"size"`
+	// ContentHash is the current frontmatter.ContentHash of the note
+	ContentHash string `json:"content_hash"`
+	// Summary is nil if the note has no summary
+	Summary *Summary `json:"summary,omitempty"`
+	// Tags are the frontmatter and inline tags of the note
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Summary is the metadata of the last summary written to a note
+type Summary struct {
+	PromptHash  string `json:"prompt_hash,omitempty"`
+	Model       string `json:"model,omitempty"`
+	ContentHash string `json:"content_hash,omitempty"`
+}
+
+// Matches reports whether the entry is still valid for a file with the given modification time and size
+func (e Entry) Matches(modTime time.Time, size int64) bool {
+	return e.ModTime.Equal(modTime) && e.Size == size
+}
+
+type file struct {
+	Version     int              `json:"version"`
+	Fingerprint string           `json:"fingerprint"`
+	Files       map[string]Entry `json:"files"`
+}
+
+// Store caches the entries of all notes of a vault keyed by their vault relative, slash separated path.
+// It is safe for concurrent use.
+type Store struct {
+	path        string
+	fingerprint string
+
+	mu      sync.Mutex
+	entries map[string]Entry
+}
+
+// Open loads the state of the vault at root. A missing or unreadable state file, or one written
+// with another fingerprint (e.g. other frontmatter keys), results in an empty store.
+func Open(root, fingerprint string) *Store {
+	s := &Store{
+		path:        filepath.Join(root, Dir, FileName),
+		fingerprint: fingerprint,
+		entries:     map[string]Entry{},
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return s
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil || f.Version != version || f.Fingerprint != fingerprint {
+		return s
+	}
+	if f.Files != nil {
+		s.entries = f.Files
+	}
+	return s
+}
+
+// Get returns the entry of the note at path
+func (s *Store) Get(path string) (Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[filepath.ToSlash(path)]
+	return e, ok
+}
+
+// Put sets the entry of the note at path
+func (s *Store) Put(path string, e Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[filepath.ToSlash(path)] = e
+}
+
+// Forget removes the entry of the note at path, so it is read again by the next scan
+func (s *Store) Forget(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, filepath.ToSlash(path))
+}
+
+// Retain removes the entries of all notes for which keep returns false, e.g. deleted notes
+func (s *Store) Retain(keep func(path string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path := range s.entries {
+		if !keep(path) {
+			delete(s.entries, path)
+		}
+	}
+}
+
+// Len returns the number of entries
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Save writes the state file atomically, creating its directory if needed
+func (s *Store) Save() error {
+	s.mu.Lock()
+	data, err := json.Marshal(file{Version: version, Fingerprint: s.fingerprint, Files: s.entries})
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	return fsutil.WriteFileAtomic(s.path, data, false)
+}
@@ -0,0 +1,69 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	entry := Entry{
+		ModTime:     modTime,
+		Size:        42,
+		ContentHash: "abc",
+		Summary:     &Summary{PromptHash: "p", Model: "openai/gpt", ContentHash: "abc"},
+		Tags:        []string{"a"},
+	}
+
+	s := Open(root, "keys")
+	s.Put(filepath.Join("notes", "a.md"), entry)
+	s.Put("b.md", Entry{Size: 1})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded := Open(root, "keys")
+	if loaded.Len() != 2 {
+		t.Fatalf("expected 2 entries, got %d", loaded.Len())
+	}
+	got, ok := loaded.Get("notes/a.md")
+	if !ok {
+		t.Fatal("entry not found")
+	}
+	if !got.Matches(modTime, 42) || got.Matches(modTime, 43) || got.Matches(modTime.Add(time.Second), 42) {
+		t.Errorf("unexpected Matches result for %+v", got)
+	}
+	if !reflect.DeepEqual(got.Summary, entry.Summary) || !reflect.DeepEqual(got.Tags, entry.Tags) || got.ContentHash != "abc" {
+		t.Errorf("expected %+v, got %+v", entry, got)
+	}
+
+	loaded.Forget("b.md")
+	loaded.Retain(func(path string) bool { return path != "notes/a.md" })
+	if loaded.Len() != 0 {
+		t.Errorf("expected no entries, got %d", loaded.Len())
+	}
+}
+
+func TestOpenDiscardsIncompatibleState(t *testing.T) {
+	root := t.TempDir()
+	s := Open(root, "keys")
+	s.Put("a.md", Entry{Size: 1})
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if got := Open(root, "other keys").Len(); got != 0 {
+		t.Errorf("expected empty store for another fingerprint, got %d entries", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, Dir, FileName), []byte("{broken"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := Open(root, "keys").Len(); got != 0 {
+		t.Errorf("expected empty store for a broken file, got %d entries", got)
+	}
+}
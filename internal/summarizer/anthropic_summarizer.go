@@ -0,0 +1,178 @@
+package summarizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// DefaultAnthropicBaseURL is the base URL of the Anthropic API
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	// DefaultAnthropicModel is the model used when neither --model nor ANTHROPIC_MODEL is set
+	DefaultAnthropicModel = "claude-3-5-haiku-latest"
+	// AnthropicVersion is the API version sent in the anthropic-version header
+	AnthropicVersion = "2023-06-01"
+	// DefaultAnthropicMaxTokens is used when no limit is configured, as the Messages API requires one
+	DefaultAnthropicMaxTokens = 4096
+
+	anthropicToolName = "text_summary"
+)
+
+func init() {
+	Register("anthropic", Provider{
+		APIKeyEnv:    "ANTHROPIC_API_KEY",
+		ModelEnv:     "ANTHROPIC_MODEL",
+		DefaultModel: DefaultAnthropicModel,
+		New: func(cfg Config) (Summarizer, error) {
+			baseURL := cfg.BaseURL
+			if baseURL == "" {
+				baseURL = DefaultAnthropicBaseURL
+			}
+			options := cfg.Options.withDefaults(RequestOptions{
+				Model: envOrDefault("ANTHROPIC_MODEL", DefaultAnthropicModel),
+			})
+			return &AnthropicSummarizer{BaseURL: baseURL, APIKey: cfg.APIKey, Options: options, Debug: cfg.Debug}, nil
+		},
+	})
+}
+
+// AnthropicSummarizer is an implementation of Summarizer using the Anthropic Messages API.
+// The structured output is obtained by forcing a single tool call whose input schema
+// is the summary/tags schema.
+type AnthropicSummarizer struct {
+	BaseURL string
+	APIKey  string
+	Options RequestOptions
+	Debug   bool
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type anthropicRequest struct {
+	Model       string              `json:"model"`
+	MaxTokens   int                 `json:"max_tokens"`
+	Temperature *float64            `json:"temperature,omitempty"`
+	TopP        *float64            `json:"top_p,omitempty"`
+	Messages    []anthropicMessage  `json:"messages"`
+	Tools       []anthropicTool     `json:"tools"`
+	ToolChoice  anthropicToolChoice `json:"tool_choice"`
+}
+
+type anthropicResponse struct {
+	Type    string `json:"type"`
+	Content []struct {
+		Type  string          `json:"type"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Error      *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Summarize generates a summary using the Anthropic Messages API
+func (s *AnthropicSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	url, err := joinURL(s.BaseURL, "v1/messages")
+	if err != nil {
+		return "", nil, err
+	}
+
+	prompt, err = renderPrompt(text, filepath, prompt, warn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	maxTokens := s.Options.MaxOutputTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultAnthropicMaxTokens
+	}
+
+	payload, err := json.Marshal(anthropicRequest{
+		Model:       s.Options.Model,
+		MaxTokens:   maxTokens,
+		Temperature: s.Options.Temperature,
+		TopP:        s.Options.TopP,
+		Messages: []anthropicMessage{
+			{Role: "user", Content: prompt},
+		},
+		Tools: []anthropicTool{
+			{
+				Name:        anthropicToolName,
+				Description: "Records the summary and the tags of the text.",
+				InputSchema: resultSchema(s.Options.TagVocabulary),
+			},
+		},
+		ToolChoice: anthropicToolChoice{Type: "tool", Name: anthropicToolName},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("payload", payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", s.APIKey)
+	req.Header.Set("anthropic-version", AnthropicVersion)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("body", body)
+	}
+
+	var msgResp anthropicResponse
+	if err := json.Unmarshal(body, &msgResp); err != nil && resp.StatusCode == http.StatusOK {
+		return "", nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || msgResp.Type == "error" {
+		if msgResp.Error != nil && msgResp.Error.Message != "" {
+			return "", nil, newAPIError(resp, msgResp.Error.Type+": "+msgResp.Error.Message)
+		}
+		return "", nil, newAPIError(resp, string(body))
+	}
+
+	for _, block := range msgResp.Content {
+		if block.Type == "tool_use" && block.Name == anthropicToolName {
+			return parseResult(string(block.Input))
+		}
+	}
+
+	return "", nil, fmt.Errorf("response contains no %s tool call, stop reason: %s", anthropicToolName, msgResp.StopReason)
+}
@@ -0,0 +1,77 @@
+package summarizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicSummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("x-api-key"); got != "secret" {
+			t.Errorf("unexpected x-api-key header: %q", got)
+		}
+		if got := r.Header.Get("anthropic-version"); got != AnthropicVersion {
+			t.Errorf("unexpected anthropic-version header: %q", got)
+		}
+
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if req.ToolChoice.Type != "tool" || req.ToolChoice.Name != anthropicToolName {
+			t.Errorf("unexpected tool_choice: %+v", req.ToolChoice)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].InputSchema == nil {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+		if req.MaxTokens <= 0 {
+			t.Errorf("max_tokens must be set")
+		}
+
+		w.Write([]byte(`{
+			"type": "message",
+			"role": "assistant",
+			"content": [
+				{"type": "text", "text": "Let me analyze the note."},
+				{"type": "tool_use", "id": "toolu_1", "name": "text_summary", "input": {"summary": "A short summary.", "tags": ["a", "b"]}}
+			],
+			"stop_reason": "tool_use"
+		}`))
+	}))
+	defer server.Close()
+
+	s := &AnthropicSummarizer{BaseURL: server.URL, APIKey: "secret", Options: RequestOptions{Model: "claude-test"}}
+	summary, tags, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}} {{Obsidian_Vault_Path}}", func(string) {})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "A short summary." {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestAnthropicSummarizerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(529)
+		w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+	}))
+	defer server.Close()
+
+	s := &AnthropicSummarizer{BaseURL: server.URL, APIKey: "secret", Options: RequestOptions{Model: "claude-test"}}
+	_, _, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}}", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "overloaded_error: Overloaded") {
+		t.Fatalf("expected overloaded error, got %v", err)
+	}
+}
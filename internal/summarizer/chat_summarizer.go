@@ -0,0 +1,181 @@
+package summarizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+func init() {
+	Register("openai-chat", Provider{
+		APIKeyEnv:      "OPENAI_API_KEY",
+		APIKeyOptional: true,
+		ModelEnv:       "OPENAI_MODEL",
+		DefaultModel:   DefaultOpenAIModel,
+		New: func(cfg Config) (Summarizer, error) {
+			baseURL := cfg.BaseURL
+			if baseURL == "" {
+				baseURL = DefaultOpenAIBaseURL
+			}
+			options := cfg.Options.withDefaults(RequestOptions{
+				Model: envOrDefault("OPENAI_MODEL", DefaultOpenAIModel),
+			})
+			return &ChatSummarizer{BaseURL: baseURL, APIKey: cfg.APIKey, Options: options, Debug: cfg.Debug}, nil
+		},
+	})
+}
+
+// ChatSummarizer is an implementation of Summarizer using the OpenAI compatible
+// Chat Completions API, as served by vLLM, LM Studio, llama.cpp, LiteLLM or Azure.
+type ChatSummarizer struct {
+	BaseURL string
+	APIKey  string
+	Options RequestOptions
+	Debug   bool
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatJSONSchema struct {
+	Name   string `json:"name"`
+	Strict bool   `json:"strict"`
+	Schema any    `json:"schema"`
+}
+
+type chatResponseFormat struct {
+	Type       string         `json:"type"`
+	JSONSchema chatJSONSchema `json:"json_schema"`
+}
+
+type chatRequest struct {
+	Model          string             `json:"model"`
+	Messages       []chatMessage      `json:"messages"`
+	ResponseFormat chatResponseFormat `json:"response_format"`
+	Temperature    *float64           `json:"temperature,omitempty"`
+	TopP           *float64           `json:"top_p,omitempty"`
+	MaxTokens      int                `json:"max_tokens,omitempty"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+			Refusal string `json:"refusal"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// Summarize generates a summary using the Chat Completions API
+func (s *ChatSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	url, err := joinURL(s.BaseURL, "chat/completions")
+	if err != nil {
+		return "", nil, err
+	}
+
+	prompt, err = renderPrompt(text, filepath, prompt, warn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := json.Marshal(chatRequest{
+		Model: s.Options.Model,
+		Messages: []chatMessage{
+			{Role: "user", Content: prompt},
+		},
+		ResponseFormat: chatResponseFormat{
+			Type: "json_schema",
+			JSONSchema: chatJSONSchema{
+				Name:   "text_summary",
+				Strict: true,
+				Schema: resultSchema(s.Options.TagVocabulary),
+			},
+		},
+		Temperature: s.Options.Temperature,
+		TopP:        s.Options.TopP,
+		MaxTokens:   s.Options.MaxOutputTokens,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("payload", payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.APIKey)
+		// Azure OpenAI authenticates with its own header
+		if strings.HasSuffix(req.URL.Hostname(), ".azure.com") {
+			req.Header.Set("api-key", s.APIKey)
+		}
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("body", body)
+	}
+
+	var chatResp chatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil && resp.StatusCode == http.StatusOK {
+		return "", nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if chatResp.Error != nil && chatResp.Error.Message != "" {
+			return "", nil, newAPIError(resp, chatResp.Error.Message)
+		}
+		return "", nil, newAPIError(resp, string(body))
+	}
+
+	if len(chatResp.Choices) == 0 {
+		return "", nil, fmt.Errorf("response contains no choices")
+	}
+	message := chatResp.Choices[0].Message
+	if message.Refusal != "" {
+		return "", nil, fmt.Errorf("model refused: %s", message.Refusal)
+	}
+
+	return parseResult(message.Content)
+}
+
+// joinURL appends path to the path of base, keeping any query parameters of base
+func joinURL(base, path string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL %q: %w", base, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid base URL %q: scheme and host are required", base)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + strings.TrimPrefix(path, "/")
+	return u.String(), nil
+}
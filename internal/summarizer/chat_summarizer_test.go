@@ -0,0 +1,95 @@
+package summarizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatSummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("unexpected Authorization header: %q", got)
+		}
+
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if req.ResponseFormat.Type != "json_schema" || req.ResponseFormat.JSONSchema.Schema == nil {
+			t.Errorf("unexpected response_format: %+v", req.ResponseFormat)
+		}
+		if len(req.Messages) != 1 || !strings.Contains(req.Messages[0].Content, "note body") {
+			t.Errorf("prompt not rendered: %+v", req.Messages)
+		}
+
+		w.Write([]byte(`{
+			"choices": [
+				{
+					"index": 0,
+					"message": {"role": "assistant", "content": "{\"summary\": \"A short summary.\", \"tags\": [\"a\", \"b\"]}"},
+					"finish_reason": "stop"
+				}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	s := &ChatSummarizer{BaseURL: server.URL + "/v1/", APIKey: "secret", Options: RequestOptions{Model: "local-model"}}
+	summary, tags, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}} {{Obsidian_Vault_Path}}", func(string) {})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "A short summary." {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestChatSummarizerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "Incorrect API key provided", "type": "invalid_request_error"}}`))
+	}))
+	defer server.Close()
+
+	s := &ChatSummarizer{BaseURL: server.URL, Options: RequestOptions{Model: "local-model"}}
+	_, _, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}}", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "Incorrect API key") {
+		t.Fatalf("expected API key error, got %v", err)
+	}
+}
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base, path, expected string
+	}{
+		{"https://api.openai.com/v1", "chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{"http://localhost:8000/v1/", "chat/completions", "http://localhost:8000/v1/chat/completions"},
+		{"http://localhost:11434", "api/chat", "http://localhost:11434/api/chat"},
+		{"https://x.openai.azure.com/openai/deployments/d?api-version=2024-06-01", "chat/completions", "https://x.openai.azure.com/openai/deployments/d/chat/completions?api-version=2024-06-01"},
+	}
+	for _, tt := range tests {
+		got, err := joinURL(tt.base, tt.path)
+		if err != nil {
+			t.Fatalf("joinURL(%q, %q) failed: %v", tt.base, tt.path, err)
+		}
+		if got != tt.expected {
+			t.Errorf("joinURL(%q, %q) = %q, expected %q", tt.base, tt.path, got, tt.expected)
+		}
+	}
+
+	if _, err := joinURL("localhost", "api/chat"); err == nil {
+		t.Error("expected error for base URL without scheme")
+	}
+}
@@ -0,0 +1,91 @@
+package summarizer
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/chunk"
+)
+
+// ChunkPrompt is the prompt summarizing a single chunk of a note too long to be summarized at once
+//
+//go:embed embed/chunk_prompt.md
+var ChunkPrompt string
+
+// ChunkedSummarizer wraps a Summarizer and summarizes texts longer than Limit with map-reduce:
+// the text is split into chunks at Markdown headings and paragraphs, every chunk is summarized
+// with ChunkPrompt and the summaries of the chunks are summarized with the prompt of the note.
+type ChunkedSummarizer struct {
+	Summarizer Summarizer
+	// Limit is the maximum number of runes of the text of a single call
+	Limit int
+	// Model is part of the cache key, so the chunks are summarized again by another model
+	Model string
+	// Cache keeps the summaries of the chunks, so a failed note resumes with the missing chunks. Nil disables it.
+	Cache *chunk.Cache
+}
+
+// WithChunking wraps s so texts longer than limit are summarized in chunks.
+// Wrap it around WithRetry, so every chunk is retried on its own.
+func WithChunking(s Summarizer, limit int, model string, cache *chunk.Cache) Summarizer {
+	if limit <= 0 {
+		return s
+	}
+	return &ChunkedSummarizer{Summarizer: s, Limit: limit, Model: model, Cache: cache}
+}
+
+// Summarize summarizes text in a single call if it fits into the limit, else in chunks
+func (c *ChunkedSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	note := filepath
+	if c.Cache != nil {
+		note = c.Cache.Note(filepath)
+	}
+	return c.summarize(ctx, text, filepath, note, prompt, warn)
+}
+
+// summarize reduces the summaries of the chunks again if they are still too long.
+// note is the cache key of the text, so the chunks of every reduction are cached separately.
+func (c *ChunkedSummarizer) summarize(ctx context.Context, text, filepath, note, prompt string, warn func(string)) (string, []string, error) {
+	if utf8.RuneCountInString(text) <= c.Limit {
+		return c.Summarizer.Summarize(ctx, text, filepath, prompt, warn)
+	}
+
+	chunks := chunk.Split(text, c.Limit)
+	keys := make([]string, len(chunks))
+	summaries := make([]string, len(chunks))
+	for i, part := range chunks {
+		keys[i] = ComputeHash(c.Model + "\x00" + ChunkPrompt + "\x00" + part)
+		if c.Cache != nil {
+			if r, ok := c.Cache.Get(note, keys[i]); ok {
+				summaries[i] = r.Summary
+				continue
+			}
+		}
+
+		summary, tags, err := c.Summarizer.Summarize(ctx, part, fmt.Sprintf("%s (part %d of %d)", filepath, i+1, len(chunks)), ChunkPrompt, warn)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to summarize part %d of %d: %w", i+1, len(chunks), err)
+		}
+		if c.Cache != nil {
+			c.Cache.Put(note, keys[i], chunk.Result{Summary: summary, Tags: tags})
+		}
+		summaries[i] = summary
+	}
+	if c.Cache != nil {
+		c.Cache.Retain(note, keys)
+	}
+
+	var b strings.Builder
+	b.WriteString("The note is too long to be given at once. These are the summaries of its consecutive parts:\n")
+	for i, summary := range summaries {
+		fmt.Fprintf(&b, "\nPart %d of %d:\n%s\n", i+1, len(summaries), strings.TrimSpace(summary))
+	}
+	reduced := b.String()
+	if len(reduced) >= len(text) {
+		return "", nil, fmt.Errorf("summaries of the %d parts are not shorter than the note", len(chunks))
+	}
+	return c.summarize(ctx, reduced, filepath, note+chunk.ReduceSuffix, prompt, warn)
+}
@@ -0,0 +1,87 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/chunk"
+)
+
+// recordingSummarizer returns the first line of the text as summary and fails for texts containing fail
+type recordingSummarizer struct {
+	texts   []string
+	prompts []string
+	fail    string
+}
+
+func (r *recordingSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	r.texts = append(r.texts, text)
+	r.prompts = append(r.prompts, prompt)
+	if r.fail != "" && strings.Contains(text, r.fail) {
+		return "", nil, errors.New("failed")
+	}
+	line, _, _ := strings.Cut(text, "\n")
+	return line, []string{"tag"}, nil
+}
+
+func TestChunkedSummarizer(t *testing.T) {
+	text := "# A\n" + strings.Repeat("a", 200) + "\n# B\n" + strings.Repeat("b", 200) + "\n# C\n" + strings.Repeat("c", 200) + "\n"
+	ctx := context.Background()
+	warn := func(string) {}
+
+	t.Run("Short text", func(t *testing.T) {
+		inner := &recordingSummarizer{}
+		s := WithChunking(inner, 1000, "model", nil)
+		if summary, _, err := s.Summarize(ctx, text, "note.md", "prompt", warn); err != nil || summary != "# A" {
+			t.Errorf("unexpected summary %q (%v)", summary, err)
+		}
+		if len(inner.texts) != 1 {
+			t.Errorf("expected a single call, got %d", len(inner.texts))
+		}
+	})
+
+	t.Run("Map reduce with resume", func(t *testing.T) {
+		cache := chunk.OpenCache(t.TempDir())
+		inner := &recordingSummarizer{fail: "# B"}
+		s := WithChunking(inner, 250, "model", cache)
+
+		if _, _, err := s.Summarize(ctx, text, "note.md", "prompt", warn); err == nil {
+			t.Fatal("expected the failing chunk to fail the note")
+		}
+		if cache.Len() != 1 {
+			t.Errorf("expected the first chunk to be cached, got %d", cache.Len())
+		}
+
+		inner = &recordingSummarizer{}
+		s = WithChunking(inner, 250, "model", cache)
+		summary, _, err := s.Summarize(ctx, text, "note.md", "prompt", warn)
+		if err != nil {
+			t.Fatalf("Summarize failed: %v", err)
+		}
+		// the cached chunk A is skipped, B and C are summarized before the reduction
+		if len(inner.texts) != 3 || !strings.HasPrefix(inner.texts[0], "# B") || !strings.HasPrefix(inner.texts[1], "# C") {
+			t.Fatalf("unexpected calls %q", inner.texts)
+		}
+		if inner.prompts[0] != ChunkPrompt || inner.prompts[2] != "prompt" {
+			t.Errorf("expected the chunk prompt for chunks and the note prompt for the reduction")
+		}
+		reduced := inner.texts[2]
+		for _, part := range []string{"Part 1 of 3:\n# A", "Part 2 of 3:\n# B", "Part 3 of 3:\n# C"} {
+			if !strings.Contains(reduced, part) {
+				t.Errorf("expected %q in the reduced text %q", part, reduced)
+			}
+		}
+		if summary != strings.SplitN(reduced, "\n", 2)[0] {
+			t.Errorf("expected the summary of the reduction, got %q", summary)
+		}
+
+		// Another model does not use the cached chunks
+		inner = &recordingSummarizer{}
+		WithChunking(inner, 250, "other", cache).Summarize(ctx, text, "note.md", "prompt", warn)
+		if len(inner.texts) != 4 {
+			t.Errorf("expected all chunks to be summarized again, got %d calls", len(inner.texts))
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package summarizer
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error classes of failed API calls, use errors.Is to test an error against them
+var (
+	ErrRateLimited    = errors.New("rate limited")
+	ErrTransient      = errors.New("transient server error")
+	ErrAuth           = errors.New("authentication failed")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrUnexpected     = errors.New("unexpected response")
+)
+
+// APIError is returned by the providers for every non successful HTTP response
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is the delay requested by the server, 0 if none was given
+	RetryAfter time.Duration
+	kind       error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d, %s: %s", e.StatusCode, e.kind, e.Message)
+}
+
+// Unwrap returns the error class, e.g. ErrRateLimited
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// newAPIError classifies a failed response by its status code and reads the retry headers
+func newAPIError(resp *http.Response, message string) *APIError {
+	now := time.Now()
+	kind := classifyStatus(resp.StatusCode)
+	delay := retryAfter(resp.Header, now)
+	if delay == 0 && kind == ErrRateLimited {
+		delay = rateLimitReset(resp.Header, now)
+	}
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: delay,
+		kind:       kind,
+	}
+}
+
+func classifyStatus(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusRequestTimeout, status >= 500:
+		// includes 529 used by Anthropic when overloaded
+		return ErrTransient
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrAuth
+	case status >= 400:
+		return ErrInvalidRequest
+	default:
+		return ErrUnexpected
+	}
+}
+
+// retryAfter returns the delay requested by the Retry-After or retry-after-ms header,
+// 0 if none of them is present
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("retry-after-ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.ParseFloat(v, 64); err == nil && seconds > 0 {
+			return time.Duration(seconds * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil && t.After(now) {
+			return t.Sub(now)
+		}
+	}
+	return 0
+}
+
+// rateLimitReset returns the time until the provider specific rate limit reset headers
+// allow new requests, 0 if none of them is present.
+func rateLimitReset(h http.Header, now time.Time) time.Duration {
+	// OpenAI sends durations like "1s" or "6m0s", Anthropic sends RFC 3339 timestamps.
+	// The longest reset wins, as every exhausted limit must be replenished.
+	var longest time.Duration
+	for name, values := range h {
+		name = strings.ToLower(name)
+		if !(strings.HasPrefix(name, "x-ratelimit-reset-") || strings.HasPrefix(name, "anthropic-ratelimit-") && strings.HasSuffix(name, "-reset")) {
+			continue
+		}
+		for _, v := range values {
+			var d time.Duration
+			if parsed, err := time.ParseDuration(v); err == nil {
+				d = parsed
+			} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+				d = t.Sub(now)
+			}
+			if d > longest {
+				longest = d
+			}
+		}
+	}
+	return longest
+}
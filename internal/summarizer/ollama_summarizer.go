@@ -0,0 +1,148 @@
+package summarizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	// DefaultOllamaURL is the address of a local Ollama server
+	DefaultOllamaURL = "http://localhost:11434"
+	// DefaultOllamaModel is the model used when neither --model nor OLLAMA_MODEL is set
+	DefaultOllamaModel = "llama3.2"
+)
+
+func init() {
+	Register("ollama", Provider{
+		ModelEnv:     "OLLAMA_MODEL",
+		DefaultModel: DefaultOllamaModel,
+		New: func(cfg Config) (Summarizer, error) {
+			baseURL := cfg.BaseURL
+			if baseURL == "" {
+				baseURL = os.Getenv("OLLAMA_HOST")
+			}
+			if baseURL == "" {
+				baseURL = DefaultOllamaURL
+			}
+			if !strings.Contains(baseURL, "://") {
+				baseURL = "http://" + baseURL
+			}
+			options := cfg.Options.withDefaults(RequestOptions{
+				Model: envOrDefault("OLLAMA_MODEL", DefaultOllamaModel),
+			})
+			return &OllamaSummarizer{BaseURL: baseURL, Options: options, Debug: cfg.Debug}, nil
+		},
+	})
+}
+
+// OllamaSummarizer is an implementation of Summarizer using a local Ollama server,
+// so note content never leaves the machine
+type OllamaSummarizer struct {
+	BaseURL string
+	Options RequestOptions
+	Debug   bool
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Format   any             `json:"format"`
+	Options  ollamaOptions   `json:"options"`
+	Stream   bool            `json:"stream"`
+}
+
+type ollamaChatResponse struct {
+	Message ollamaMessage `json:"message"`
+	Error   string        `json:"error"`
+}
+
+// Summarize generates a summary using the Ollama chat API
+func (s *OllamaSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	url, err := joinURL(s.BaseURL, "api/chat")
+	if err != nil {
+		return "", nil, err
+	}
+
+	prompt, err = renderPrompt(text, filepath, prompt, warn)
+	if err != nil {
+		return "", nil, err
+	}
+
+	payload, err := json.Marshal(ollamaChatRequest{
+		Model: s.Options.Model,
+		Messages: []ollamaMessage{
+			{Role: "user", Content: prompt},
+		},
+		Format: resultSchema(s.Options.TagVocabulary),
+		Options: ollamaOptions{
+			Temperature: s.Options.Temperature,
+			TopP:        s.Options.TopP,
+			NumPredict:  s.Options.MaxOutputTokens,
+		},
+		Stream: false,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("payload", payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if s.Debug {
+		writeDebugFile("body", body)
+	}
+
+	var chatResp ollamaChatResponse
+	if err := json.Unmarshal(body, &chatResp); err != nil && resp.StatusCode == http.StatusOK {
+		return "", nil, fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		if chatResp.Error != "" {
+			return "", nil, newAPIError(resp, chatResp.Error)
+		}
+		return "", nil, newAPIError(resp, string(body))
+	}
+
+	if chatResp.Message.Content == "" {
+		return "", nil, fmt.Errorf("empty response from model %s", s.Options.Model)
+	}
+
+	return parseResult(chatResp.Message.Content)
+}
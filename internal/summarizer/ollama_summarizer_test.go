@@ -0,0 +1,73 @@
+package summarizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOllamaSummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if req.Model != "test-model" {
+			t.Errorf("unexpected model: %s", req.Model)
+		}
+		if req.Stream {
+			t.Error("expected stream to be false")
+		}
+		if req.Format == nil {
+			t.Error("expected format schema")
+		}
+		if len(req.Messages) != 1 || !strings.Contains(req.Messages[0].Content, "note body") {
+			t.Errorf("prompt not rendered: %+v", req.Messages)
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"model": "test-model",
+			"message": map[string]any{
+				"role":    "assistant",
+				"content": `{"summary": "A short summary.", "tags": ["a", "b"]}`,
+			},
+			"done": true,
+		})
+	}))
+	defer server.Close()
+
+	s := &OllamaSummarizer{BaseURL: server.URL, Options: RequestOptions{Model: "test-model"}}
+	summary, tags, err := s.Summarize(context.Background(), "note body", "folder/note.md", "{{Text}} {{Obsidian_Vault_Path}}", func(string) {})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "A short summary." {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestOllamaSummarizerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": "model \"missing\" not found, try pulling it first"}`))
+	}))
+	defer server.Close()
+
+	s := &OllamaSummarizer{BaseURL: server.URL, Options: RequestOptions{Model: "missing"}}
+	_, _, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}}", func(string) {})
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
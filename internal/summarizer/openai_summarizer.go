@@ -1,110 +1,130 @@
 package summarizer
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"strings"
-	"time"
 
 	"github.com/oliveagle/jsonpath"
 )
 
-// Summarizer is an interface for summarizing text
-type Summarizer interface {
-	Summarize(text, prompt string) (string, []string, error)
+const (
+	// DefaultOpenAIBaseURL is the base URL of the OpenAI API
+	DefaultOpenAIBaseURL = "https://api.openai.com/v1"
+	// DefaultOpenAIModel is the model used when neither --model nor OPENAI_MODEL is set
+	DefaultOpenAIModel = "gpt-4o-mini"
+)
+
+func init() {
+	Register("openai", Provider{
+		APIKeyEnv:    "OPENAI_API_KEY",
+		ModelEnv:     "OPENAI_MODEL",
+		DefaultModel: DefaultOpenAIModel,
+		New: func(cfg Config) (Summarizer, error) {
+			baseURL := cfg.BaseURL
+			if baseURL == "" {
+				baseURL = DefaultOpenAIBaseURL
+			}
+			options := cfg.Options.withDefaults(RequestOptions{
+				Model:           envOrDefault("OPENAI_MODEL", DefaultOpenAIModel),
+				Temperature:     Float(1),
+				TopP:            Float(1),
+				MaxOutputTokens: 10000,
+			})
+			return &OpenAISummarizer{BaseURL: baseURL, APIKey: cfg.APIKey, Options: options, Debug: cfg.Debug}, nil
+		},
+	})
 }
 
 // OpenAISummarizer is an implementation of Summarizer using OpenAI
 type OpenAISummarizer struct {
-	APIKey string
-	Debug  bool
+	BaseURL string
+	APIKey  string
+	Options RequestOptions
+	Debug   bool
 }
 
-const (
-	PlaceholderText = `{{Text}}`
-	PlaceholerPath  = `{{Obsidian_Vault_Path}}`
-)
+type openAIContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
 
-// Summarize generates a summary using the OpenAI API
-func (s *OpenAISummarizer) Summarize(text, filepath, prompt string, warn func(string)) (string, []string, error) {
-	url := "https://api.openai.com/v1/responses"
+type openAIInput struct {
+	Role    string          `json:"role"`
+	Content []openAIContent `json:"content"`
+}
 
-	if strings.Contains(prompt, PlaceholderText) {
-		prompt = strings.ReplaceAll(prompt, PlaceholderText, text)
-	} else {
-		return "", nil, fmt.Errorf("prompt must contain " + PlaceholderText + " placeholder")
-	}
+type openAIFormat struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Strict bool   `json:"strict"`
+	Schema any    `json:"schema"`
+}
+
+type openAIText struct {
+	Format openAIFormat `json:"format"`
+}
+
+type openAIRequest struct {
+	Model           string        `json:"model"`
+	Input           []openAIInput `json:"input"`
+	Text            openAIText    `json:"text"`
+	Reasoning       struct{}      `json:"reasoning"`
+	Tools           []any         `json:"tools"`
+	Temperature     *float64      `json:"temperature,omitempty"`
+	MaxOutputTokens int           `json:"max_output_tokens,omitempty"`
+	TopP            *float64      `json:"top_p,omitempty"`
+	Store           bool          `json:"store"`
+}
 
-	if strings.Contains(prompt, PlaceholerPath) {
-		prompt = strings.ReplaceAll(prompt, PlaceholerPath, filepath)
-	} else {
-		warn("Warning: prompt does not contain " + PlaceholerPath + " placeholder")
+// Summarize generates a summary using the OpenAI API
+func (s *OpenAISummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	url, err := joinURL(s.BaseURL, "responses")
+	if err != nil {
+		return "", nil, err
 	}
 
-	escapedPrompt, err := json.Marshal(prompt)
+	prompt, err = renderPrompt(text, filepath, prompt, warn)
 	if err != nil {
-		return "", nil, fmt.Errorf("failed to escape prompt to JSON: %w", err)
+		return "", nil, err
 	}
 
-	payload := fmt.Sprintf(`{
-		"model": "gpt-4o-mini",
-		"input": [
+	payload, err := json.Marshal(openAIRequest{
+		Model: s.Options.Model,
+		Input: []openAIInput{
 			{
-				"role": "user",
-				"content": [
-					{
-						"type": "input_text",
-						"text": %s
-					}
-				]
-			}
-		],
-		"text": {
-			"format": {
-				"type": "json_schema",
-				"name": "text_summary",
-				"strict": true,
-				"schema": {
-					"type": "object",
-					"properties": {
-						"summary": {
-							"type": "string",
-							"description": "A summary of the text."
-						},
-						"tags": {
-							"type": "array",
-							"description": "An array of tags associated with the text.",
-							"items": {
-								"type": "string"
-							}
-						}
-					},
-					"required": ["summary", "tags"],
-					"additionalProperties": false
-				}
-			}
+				Role: "user",
+				Content: []openAIContent{
+					{Type: "input_text", Text: prompt},
+				},
+			},
+		},
+		Text: openAIText{
+			Format: openAIFormat{
+				Type:   "json_schema",
+				Name:   "text_summary",
+				Strict: true,
+				Schema: resultSchema(s.Options.TagVocabulary),
+			},
 		},
-		"reasoning": {},
-		"tools": [],
-		"temperature": 1,
-		"max_output_tokens": 10000,
-		"top_p": 1,
-		"store": false
-	}`, string(escapedPrompt))
+		Tools:           []any{},
+		Temperature:     s.Options.Temperature,
+		MaxOutputTokens: s.Options.MaxOutputTokens,
+		TopP:            s.Options.TopP,
+		Store:           false,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
 
 	if s.Debug {
-		timestamp := time.Now().Format("20060102_150405")
-		filename := fmt.Sprintf("debug_%s_payload.json", timestamp)
-		err := os.WriteFile(filename, []byte(payload), 0644)
-		if err != nil {
-			fmt.Printf("Failed to write debug payload to file: %v\n", err)
-		}
+		writeDebugFile("payload", payload)
 	}
 
-	req, err := http.NewRequest("POST", url, strings.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -125,16 +145,19 @@ func (s *OpenAISummarizer) Summarize(text, filepath, prompt string, warn func(st
 	}
 
 	if s.Debug {
-		timestamp := time.Now().Format("20060102_150405")
-		filename := fmt.Sprintf("debug_%s_body.json", timestamp)
-		err := os.WriteFile(filename, body, 0644)
-		if err != nil {
-			fmt.Printf("Failed to write debug body to file: %v\n", err)
-		}
+		writeDebugFile("body", body)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", nil, fmt.Errorf("unexpected status code: %d, body: %v", resp.StatusCode, string(body))
+		var errResp struct {
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil && errResp.Error.Message != "" {
+			return "", nil, newAPIError(resp, errResp.Error.Message)
+		}
+		return "", nil, newAPIError(resp, string(body))
 	}
 
 	// Use JSONPath to extract the `text` field
@@ -149,14 +172,11 @@ func (s *OpenAISummarizer) Summarize(text, filepath, prompt string, warn func(st
 		return "", nil, fmt.Errorf("failed to extract text using JSONPath: %w", err)
 	}
 
-	// Parse the extracted text as JSON to get `summary` and `tags`
-	var parsedOutput struct {
-		Summary string   `json:"summary"`
-		Tags    []string `json:"tags"`
-	}
-	if err := json.Unmarshal([]byte(extractedText.(string)), &parsedOutput); err != nil {
-		return "", nil, fmt.Errorf("failed to parse extracted text: %w", err)
+	extractedString, ok := extractedText.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("unexpected type %T at %s", extractedText, textPath)
 	}
 
-	return parsedOutput.Summary, parsedOutput.Tags, nil
+	// Parse the extracted text as JSON to get `summary` and `tags`
+	return parseResult(extractedString)
 }
@@ -0,0 +1,60 @@
+package summarizer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestOpenAISummarizer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+			return
+		}
+		if req["model"] != "gpt-test" {
+			t.Errorf("unexpected model: %v", req["model"])
+		}
+		// temperature 0 must be sent and not be dropped as zero value
+		if temperature, ok := req["temperature"]; !ok || temperature != 0.0 {
+			t.Errorf("unexpected temperature: %v", req["temperature"])
+		}
+		if _, ok := req["top_p"]; ok {
+			t.Errorf("top_p must be omitted when unset")
+		}
+		if req["max_output_tokens"] != 500.0 {
+			t.Errorf("unexpected max_output_tokens: %v", req["max_output_tokens"])
+		}
+
+		w.Write([]byte(`{
+			"output": [
+				{"type": "message", "content": [{"type": "output_text", "text": "{\"summary\": \"A short summary.\", \"tags\": [\"a\", \"b\"]}"}]}
+			]
+		}`))
+	}))
+	defer server.Close()
+
+	s := &OpenAISummarizer{
+		BaseURL: server.URL + "/v1",
+		APIKey:  "secret",
+		Options: RequestOptions{Model: "gpt-test", Temperature: Float(0), MaxOutputTokens: 500},
+	}
+	summary, tags, err := s.Summarize(context.Background(), "note body", "note.md", "{{Text}} {{Obsidian_Vault_Path}}", func(string) {})
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if summary != "A short summary." {
+		t.Errorf("unexpected summary: %q", summary)
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
@@ -0,0 +1,45 @@
+package summarizer
+
+import "os"
+
+// RequestOptions are the model parameters sent with every request.
+// Zero values are not sent, so the default of the provider or the model applies.
+type RequestOptions struct {
+	Model string
+	// Temperature is a pointer because 0 is a valid and useful value for reproducible runs
+	Temperature     *float64
+	TopP            *float64
+	MaxOutputTokens int
+	// TagVocabulary restricts the tags of the result to these values, empty allows any tag
+	TagVocabulary []string
+}
+
+// withDefaults returns a copy of o where unset values are taken from defaults
+func (o RequestOptions) withDefaults(defaults RequestOptions) RequestOptions {
+	if o.Model == "" {
+		o.Model = defaults.Model
+	}
+	if o.Temperature == nil {
+		o.Temperature = defaults.Temperature
+	}
+	if o.TopP == nil {
+		o.TopP = defaults.TopP
+	}
+	if o.MaxOutputTokens == 0 {
+		o.MaxOutputTokens = defaults.MaxOutputTokens
+	}
+	return o
+}
+
+// Float returns a pointer to v, for use in RequestOptions
+func Float(v float64) *float64 {
+	return &v
+}
+
+// envOrDefault returns the value of the environment variable key or def if it is empty
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,30 @@
+package summarizer
+
+import (
+	"context"
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/ratelimit"
+)
+
+// RateLimitedSummarizer wraps a Summarizer and paces every call through a shared limiter
+type RateLimitedSummarizer struct {
+	Summarizer Summarizer
+	Limiter    *ratelimit.Limiter
+}
+
+// WithRateLimit wraps s so every call waits for the limiter. Wrap it inside WithRetry,
+// so retried attempts are paced as well.
+func WithRateLimit(s Summarizer, limiter *ratelimit.Limiter) Summarizer {
+	if limiter == nil {
+		return s
+	}
+	return &RateLimitedSummarizer{Summarizer: s, Limiter: limiter}
+}
+
+// Summarize waits until the estimated input tokens of text and prompt fit into the budget
+// and then calls the wrapped Summarizer. It returns early if ctx is cancelled while waiting.
+func (r *RateLimitedSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	if err := r.Limiter.Wait(ctx, ratelimit.EstimateTokens(len(text)+len(prompt))); err != nil {
+		return "", nil, err
+	}
+	return r.Summarizer.Summarize(ctx, text, filepath, prompt, warn)
+}
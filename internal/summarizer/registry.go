@@ -0,0 +1,109 @@
+package summarizer
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Config holds the settings shared by all providers
+type Config struct {
+	APIKey string
+	// BaseURL overrides the default endpoint of the provider
+	BaseURL string
+	// Options are the model parameters, unset values fall back to the provider defaults
+	Options RequestOptions
+	Debug   bool
+}
+
+// Factory creates a Summarizer from a Config
+type Factory func(cfg Config) (Summarizer, error)
+
+// Provider describes a registered summarization backend
+type Provider struct {
+	// APIKeyEnv is the environment variable used as fallback for the API key.
+	// An empty value means the provider does not need an API key.
+	APIKeyEnv string
+	// APIKeyOptional allows running without an API key, e.g. for self-hosted servers
+	APIKeyOptional bool
+	// ModelEnv is the environment variable overriding DefaultModel
+	ModelEnv string
+	// DefaultModel is the model used when none is configured
+	DefaultModel string
+	// New creates a new instance of the provider
+	New Factory
+}
+
+// Model returns the model the provider uses: model if set, else the value of ModelEnv or DefaultModel
+func (p Provider) Model(model string) string {
+	if model != "" {
+		return model
+	}
+	if p.ModelEnv != "" {
+		return envOrDefault(p.ModelEnv, p.DefaultModel)
+	}
+	return p.DefaultModel
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Provider{}
+)
+
+// DefaultProvider is the name of the provider used when none is given
+const DefaultProvider = "openai"
+
+// Register makes a provider available under the given name.
+// It panics if the name is empty, the factory is nil or the name is already registered.
+func Register(name string, p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" {
+		panic("summarizer: Register with empty name")
+	}
+	if p.New == nil {
+		panic("summarizer: Register with nil factory for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("summarizer: Register called twice for " + name)
+	}
+	registry[name] = p
+}
+
+// Lookup returns the provider registered under the given name
+func Lookup(name string) (Provider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	p, ok := registry[name]
+	if !ok {
+		return Provider{}, fmt.Errorf("unknown provider %q, available providers: %v", name, providerNames())
+	}
+	return p, nil
+}
+
+// New creates a Summarizer for the provider registered under the given name
+func New(name string, cfg Config) (Summarizer, error) {
+	p, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return p.New(cfg)
+}
+
+// Providers returns the sorted names of all registered providers
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return providerNames()
+}
+
+func providerNames() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
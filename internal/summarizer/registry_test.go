@@ -0,0 +1,50 @@
+package summarizer
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	p, err := Lookup(DefaultProvider)
+	if err != nil {
+		t.Fatalf("Lookup(%q) failed: %v", DefaultProvider, err)
+	}
+	if p.APIKeyEnv != "OPENAI_API_KEY" {
+		t.Errorf("unexpected APIKeyEnv: %q", p.APIKeyEnv)
+	}
+
+	s, err := New(DefaultProvider, Config{APIKey: "key"})
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", DefaultProvider, err)
+	}
+	if _, ok := s.(*OpenAISummarizer); !ok {
+		t.Errorf("expected *OpenAISummarizer, got %T", s)
+	}
+
+	if _, err := Lookup("does-not-exist"); err == nil {
+		t.Error("expected error for unknown provider")
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for duplicate registration")
+		}
+	}()
+	Register(DefaultProvider, Provider{New: func(Config) (Summarizer, error) { return nil, nil }})
+}
+
+func TestProviderModel(t *testing.T) {
+	p := Provider{ModelEnv: "TEST_PROVIDER_MODEL", DefaultModel: "default"}
+	if got := p.Model(""); got != "default" {
+		t.Errorf("expected default model, got %q", got)
+	}
+	t.Setenv("TEST_PROVIDER_MODEL", "from-env")
+	if got := p.Model(""); got != "from-env" {
+		t.Errorf("expected model from environment, got %q", got)
+	}
+	if got := p.Model("flag"); got != "flag" {
+		t.Errorf("expected configured model, got %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how failed API calls are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one, values below 1 mean 1
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every further attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff as well as delays requested by the server
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is suited for long unattended runs
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    2 * time.Minute,
+}
+
+// Retryable reports whether a failed call may succeed when tried again
+func Retryable(err error) bool {
+	if errors.Is(err, ErrRateLimited) || errors.Is(err, ErrTransient) {
+		return true
+	}
+	// Timeouts and connections closed by the server, failing TLS, DNS or refused connections are permanent
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// delay returns how long to wait before the given retry (1 for the first retry).
+// A delay requested by the server is honoured, otherwise exponential backoff with jitter is used.
+// Both are capped at MaxDelay.
+func (p RetryPolicy) delay(retry int, err error) time.Duration {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return min(apiErr.RetryAfter, p.MaxDelay)
+	}
+
+	backoff := p.BaseDelay
+	for i := 1; i < retry && backoff < p.MaxDelay; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.MaxDelay)
+	if backoff <= 0 {
+		return 0
+	}
+	return min(time.Duration(rand.Int63n(int64(backoff)))+backoff/2, p.MaxDelay)
+}
+
+// RetryingSummarizer wraps a Summarizer and retries rate limited and transient failures
+type RetryingSummarizer struct {
+	Summarizer Summarizer
+	Policy     RetryPolicy
+	// sleep is replaced in tests
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// WithRetry wraps s so failed calls are retried according to policy
+func WithRetry(s Summarizer, policy RetryPolicy) *RetryingSummarizer {
+	return &RetryingSummarizer{Summarizer: s, Policy: policy, sleep: sleepContext}
+}
+
+// Summarize calls the wrapped Summarizer until it succeeds, fails permanently or
+// the maximum number of attempts is reached. Retries are reported through warn.
+// Cancelling ctx aborts the current attempt as well as any pending backoff.
+func (r *RetryingSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	maxAttempts := max(r.Policy.MaxAttempts, 1)
+	sleep := r.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	for attempt := 1; ; attempt++ {
+		summary, tags, err := r.Summarizer.Summarize(ctx, text, filepath, prompt, warn)
+		if err == nil {
+			return summary, tags, nil
+		}
+		// a cancelled request surfaces as network error, it must not be retried
+		if ctx.Err() != nil || !Retryable(err) {
+			return "", nil, err
+		}
+		if attempt >= maxAttempts {
+			return "", nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		d := r.Policy.delay(attempt, err)
+		warn(fmt.Sprintf("Retrying %s in %v (attempt %d/%d): %v", filepath, d.Round(time.Millisecond), attempt+1, maxAttempts, err))
+		if err := sleep(ctx, d); err != nil {
+			return "", nil, err
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,253 @@
+package summarizer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeSummarizer struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeSummarizer) Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return "", nil, f.errs[f.calls-1]
+	}
+	return "summary", []string{"tag"}, nil
+}
+
+func newTestResponse(status int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: header}
+}
+
+func TestRetryingSummarizer(t *testing.T) {
+	rateLimited := newAPIError(newTestResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"7"}}), "slow down")
+	serverError := newAPIError(newTestResponse(http.StatusBadGateway, nil), "bad gateway")
+	authError := newAPIError(newTestResponse(http.StatusUnauthorized, nil), "invalid key")
+
+	tests := []struct {
+		name          string
+		errs          []error
+		maxAttempts   int
+		expectErr     error
+		expectCalls   int
+		expectSummary bool
+	}{
+		{
+			name:          "Success after rate limit and server error",
+			errs:          []error{rateLimited, serverError},
+			maxAttempts:   5,
+			expectCalls:   3,
+			expectSummary: true,
+		},
+		{
+			name:        "Auth error is not retried",
+			errs:        []error{authError},
+			maxAttempts: 5,
+			expectErr:   ErrAuth,
+			expectCalls: 1,
+		},
+		{
+			name:        "Give up after max attempts",
+			errs:        []error{serverError, serverError, serverError},
+			maxAttempts: 3,
+			expectErr:   ErrTransient,
+			expectCalls: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeSummarizer{errs: tt.errs}
+			var sleeps []time.Duration
+			r := WithRetry(fake, RetryPolicy{MaxAttempts: tt.maxAttempts, BaseDelay: time.Second, MaxDelay: time.Minute})
+			r.sleep = func(_ context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			}
+
+			summary, _, err := r.Summarize(context.Background(), "text", "note.md", "{{Text}}", func(string) {})
+			if tt.expectErr != nil {
+				if !errors.Is(err, tt.expectErr) {
+					t.Fatalf("expected error %v, got %v", tt.expectErr, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.expectSummary && summary != "summary" {
+				t.Errorf("unexpected summary: %q", summary)
+			}
+			if fake.calls != tt.expectCalls {
+				t.Errorf("expected %d calls, got %d", tt.expectCalls, fake.calls)
+			}
+			if len(sleeps) != tt.expectCalls-1 {
+				t.Errorf("expected %d sleeps, got %d", tt.expectCalls-1, len(sleeps))
+			}
+		})
+	}
+}
+
+func TestRetryingSummarizerCancelled(t *testing.T) {
+	serverError := newAPIError(newTestResponse(http.StatusBadGateway, nil), "bad gateway")
+	fake := &fakeSummarizer{errs: []error{serverError, serverError}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := WithRetry(fake, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	r.sleep = func(ctx context.Context, d time.Duration) error {
+		cancel()
+		return sleepContext(ctx, d)
+	}
+
+	_, _, err := r.Summarize(ctx, "text", "note.md", "{{Text}}", func(string) {})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected 1 call, got %d", fake.calls)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+
+	rateLimited := newAPIError(newTestResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"7"}}), "")
+	if d := p.delay(1, rateLimited); d != 7*time.Second {
+		t.Errorf("expected Retry-After to be honoured, got %v", d)
+	}
+
+	longRetry := newAPIError(newTestResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"3600"}}), "")
+	if d := p.delay(1, longRetry); d != p.MaxDelay {
+		t.Errorf("expected delay to be capped at %v, got %v", p.MaxDelay, d)
+	}
+
+	serverError := newAPIError(newTestResponse(http.StatusServiceUnavailable, nil), "")
+	for retry, backoff := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 10: 10 * time.Second} {
+		d := p.delay(retry, serverError)
+		if d < backoff/2 || d >= backoff*3/2 || d > p.MaxDelay {
+			t.Errorf("retry %d: delay %v outside jitter range of %v", retry, d, backoff)
+		}
+	}
+
+	// The jitter never exceeds MaxDelay
+	for range 100 {
+		if d := p.delay(10, serverError); d > p.MaxDelay {
+			t.Fatalf("expected delay to be capped at %v, got %v", p.MaxDelay, d)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	post := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://api.example.com", Err: err}
+	}
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Rate limited", ErrRateLimited, true},
+		{"Server error", ErrTransient, true},
+		{"Invalid request", ErrInvalidRequest, false},
+		{"Timeout", post(&net.DNSError{Err: "i/o timeout", IsTimeout: true}), true},
+		{"Connection reset", post(&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"Unexpected EOF", post(io.ErrUnexpectedEOF), true},
+		{"Connection refused", post(&net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), false},
+		{"DNS failure", post(&net.DNSError{Err: "no such host", Name: "api.example.com", IsNotFound: true}), false},
+		{"TLS failure", post(errors.New("tls: failed to verify certificate")), false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.err); got != tt.expected {
+			t.Errorf("%s: Retryable = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{"No headers", http.Header{}, 0},
+		{"Retry-After seconds", http.Header{"Retry-After": []string{"20"}}, 20 * time.Second},
+		{"Retry-After HTTP date", http.Header{"Retry-After": []string{"Wed, 01 Jan 2025 12:00:30 GMT"}}, 30 * time.Second},
+		{"retry-after-ms", http.Header{"Retry-After-Ms": []string{"1500"}}, 1500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryAfter(tt.header, now); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitReset(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{"No headers", http.Header{}, 0},
+		{"OpenAI reset headers", http.Header{
+			"X-Ratelimit-Reset-Requests": []string{"1s"},
+			"X-Ratelimit-Reset-Tokens":   []string{"6m0s"},
+		}, 6 * time.Minute},
+		{"Anthropic reset headers", http.Header{
+			"Anthropic-Ratelimit-Requests-Reset": []string{"2025-01-01T12:00:45Z"},
+		}, 45 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rateLimitReset(tt.header, now); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// reset headers are sent with every response, they only matter when rate limited
+	header := http.Header{"X-Ratelimit-Reset-Tokens": []string{"30s"}}
+	if d := newAPIError(newTestResponse(http.StatusBadGateway, header), "").RetryAfter; d != 0 {
+		t.Errorf("expected no delay for server error, got %v", d)
+	}
+	if d := newAPIError(newTestResponse(http.StatusTooManyRequests, header), "").RetryAfter; d != 30*time.Second {
+		t.Errorf("expected 30s delay for rate limit, got %v", d)
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	tests := map[int]error{
+		http.StatusTooManyRequests:     ErrRateLimited,
+		http.StatusInternalServerError: ErrTransient,
+		http.StatusBadGateway:          ErrTransient,
+		529:                            ErrTransient,
+		http.StatusUnauthorized:        ErrAuth,
+		http.StatusForbidden:           ErrAuth,
+		http.StatusBadRequest:          ErrInvalidRequest,
+		http.StatusNotFound:            ErrInvalidRequest,
+	}
+	for status, expected := range tests {
+		if got := classifyStatus(status); got != expected {
+			t.Errorf("status %d: expected %v, got %v", status, expected, got)
+		}
+	}
+}
@@ -1,11 +1,27 @@
 package summarizer
 
 import (
+	"context"
 	"crypto/sha256"
 	_ "embed"
 	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Summarizer is an interface for summarizing text.
+// filepath is the path of the note within the vault and warn receives non-fatal warnings.
+// Cancelling ctx aborts the request.
+type Summarizer interface {
+	Summarize(ctx context.Context, text, filepath, prompt string, warn func(string)) (string, []string, error)
+}
 
-	"github.com/dhcgn/go-obsidian-ai-sum/internal/frontmatter"
+const (
+	PlaceholderText = `{{Text}}`
+	PlaceholerPath  = `{{Obsidian_Vault_Path}}`
 )
 
 var (
@@ -22,15 +38,84 @@ func LoadPrompt(flagPrompt string) string {
 	return defaultPrompt
 }
 
+// renderPrompt replaces the placeholders of the prompt template with the text and path
+func renderPrompt(text, filepath, prompt string, warn func(string)) (string, error) {
+	if strings.Contains(prompt, PlaceholderText) {
+		prompt = strings.ReplaceAll(prompt, PlaceholderText, text)
+	} else {
+		return "", fmt.Errorf("prompt must contain " + PlaceholderText + " placeholder")
+	}
+
+	if strings.Contains(prompt, PlaceholerPath) {
+		prompt = strings.ReplaceAll(prompt, PlaceholerPath, filepath)
+	} else {
+		warn("Warning: prompt does not contain " + PlaceholerPath + " placeholder")
+	}
+
+	return prompt, nil
+}
+
+// resultSchema returns the JSON schema of the structured output expected from every provider.
+// A non-empty vocabulary restricts the tags to these values.
+func resultSchema(vocabulary []string) map[string]any {
+	tagItems := map[string]any{
+		"type": "string",
+	}
+	if len(vocabulary) > 0 {
+		tagItems["enum"] = vocabulary
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"summary": map[string]any{
+				"type":        "string",
+				"description": "A summary of the text.",
+			},
+			"tags": map[string]any{
+				"type":        "array",
+				"description": "An array of tags associated with the text.",
+				"items":       tagItems,
+			},
+		},
+		"required":             []string{"summary", "tags"},
+		"additionalProperties": false,
+	}
+}
+
+// AddTagVocabulary appends the existing tags of the vault to the prompt,
+// so the model prefers them over inventing new spellings
+func AddTagVocabulary(prompt string, vocabulary []string) string {
+	if len(vocabulary) == 0 {
+		return prompt
+	}
+	return prompt + "\n\nThe vault already uses the following tags. Choose tags from this list whenever one fits " +
+		"and only suggest a new tag if none of them matches:\n" + strings.Join(vocabulary, ", ") + "\n"
+}
+
+// parseResult parses the structured output of a model into summary and tags
+func parseResult(text string) (string, []string, error) {
+	var parsedOutput struct {
+		Summary string   `json:"summary"`
+		Tags    []string `json:"tags"`
+	}
+	if err := json.Unmarshal([]byte(text), &parsedOutput); err != nil {
+		return "", nil, fmt.Errorf("failed to parse extracted text: %w", err)
+	}
+	return parsedOutput.Summary, parsedOutput.Tags, nil
+}
+
+// writeDebugFile writes data to a timestamped debug file in the working directory
+func writeDebugFile(kind string, data []byte) {
+	timestamp := time.Now().Format("20060102_150405")
+	filename := fmt.Sprintf("debug_%s_%s.json", timestamp, kind)
+	err := os.WriteFile(filename, data, 0644)
+	if err != nil {
+		fmt.Printf("Failed to write debug %s to file: %v\n", kind, err)
+	}
+}
+
 // ComputeHash computes the hash of the prompt (first 16 hex chars of SHA256)
 func ComputeHash(prompt string) string {
 	hash := sha256.Sum256([]byte(prompt))
 	return hex.EncodeToString(hash[:])[:16]
 }
-
-// InjectSummary injects the summary and hash into the YAML frontmatter
-func InjectSummary(filePath, summary string, tags []string, hash string) error {
-	// This function should call the UpdateFrontmatter function from the frontmatter package
-	// to update the YAML frontmatter with the new summary and hash
-	return frontmatter.UpdateFrontmatter(filePath, summary, tags, hash)
-}
@@ -0,0 +1,31 @@
+package summarizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResultSchemaVocabulary(t *testing.T) {
+	items := func(schema map[string]any) map[string]any {
+		return schema["properties"].(map[string]any)["tags"].(map[string]any)["items"].(map[string]any)
+	}
+
+	if _, ok := items(resultSchema(nil))["enum"]; ok {
+		t.Error("expected no enum without vocabulary")
+	}
+	vocabulary := []string{"a", "b"}
+	if got := items(resultSchema(vocabulary))["enum"]; !reflect.DeepEqual(got, vocabulary) {
+		t.Errorf("expected enum %v, got %v", vocabulary, got)
+	}
+}
+
+func TestAddTagVocabulary(t *testing.T) {
+	if got := AddTagVocabulary("prompt", nil); got != "prompt" {
+		t.Errorf("expected unchanged prompt, got %q", got)
+	}
+	got := AddTagVocabulary("prompt", []string{"machine-learning", "projects/ai"})
+	if !strings.HasPrefix(got, "prompt") || !strings.Contains(got, "machine-learning, projects/ai") {
+		t.Errorf("vocabulary missing in prompt: %q", got)
+	}
+}
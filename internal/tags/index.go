@@ -0,0 +1,223 @@
+package tags
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/dhcgn/go-obsidian-ai-sum/internal/fence"
+)
+
+// Index counts the tags used in a vault to offer them as vocabulary and to map
+// near-duplicate spellings back to the established tag
+type Index struct {
+	// groups holds the count of every spelling by the folded key of the tag
+	groups map[string]map[string]int
+}
+
+// NewIndex returns an empty tag index
+func NewIndex() *Index {
+	return &Index{groups: map[string]map[string]int{}}
+}
+
+// Add counts tags, invalid tags are ignored
+func (i *Index) Add(tags ...string) {
+	for _, tag := range tags {
+		normalized, ok := Normalize(tag)
+		if !ok {
+			continue
+		}
+		fold := foldKey(Key(normalized))
+		if i.groups[fold] == nil {
+			i.groups[fold] = map[string]int{}
+		}
+		i.groups[fold][normalized]++
+	}
+}
+
+// Len returns the number of distinct tags, spellings differing in case or separators count as one
+func (i *Index) Len() int {
+	return len(i.groups)
+}
+
+// Top returns the n most used tags in their established spelling, all tags if n is 0
+func (i *Index) Top(n int) []string {
+	folds := make([]string, 0, len(i.groups))
+	for fold := range i.groups {
+		folds = append(folds, fold)
+	}
+	sort.Slice(folds, func(a, b int) bool {
+		countA, countB := i.count(folds[a]), i.count(folds[b])
+		if countA != countB {
+			return countA > countB
+		}
+		return folds[a] < folds[b]
+	})
+	if n > 0 && n < len(folds) {
+		folds = folds[:n]
+	}
+
+	result := make([]string, len(folds))
+	for j, fold := range folds {
+		result[j] = i.spelling(fold)
+	}
+	return result
+}
+
+// Canonical returns the established spelling of tag. Tags differing only in case or separators,
+// plurals whose singular is in the index, as well as single typos of longer tags, are considered
+// the same tag. ok is false if the index contains no such tag.
+func (i *Index) Canonical(tag string) (string, bool) {
+	normalized, ok := Normalize(tag)
+	if !ok {
+		return "", false
+	}
+
+	fold := foldKey(Key(normalized))
+	if _, ok := i.groups[fold]; ok {
+		return i.spelling(fold), true
+	}
+	for _, singular := range singulars(fold) {
+		if _, ok := i.groups[singular]; ok {
+			return i.spelling(singular), true
+		}
+	}
+	if len([]rune(fold)) < 6 {
+		return "", false
+	}
+
+	best := ""
+	for other := range i.groups {
+		if other+"s" == fold || fold+"s" == other || !withinOneEdit(fold, other) {
+			continue
+		}
+		if best == "" || i.count(other) > i.count(best) || i.count(other) == i.count(best) && other < best {
+			best = other
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return i.spelling(best), true
+}
+
+// Canonicalize maps tags to their established spelling and removes duplicates.
+// Tags unknown to the index are kept normalized, or dropped if strict is set.
+func (i *Index) Canonicalize(tags []string, strict bool) []string {
+	var result []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		canonical, ok := i.Canonical(tag)
+		if !ok {
+			if strict {
+				continue
+			}
+			if canonical, ok = Normalize(tag); !ok {
+				continue
+			}
+		}
+		if key := Key(canonical); !seen[key] {
+			seen[key] = true
+			result = append(result, canonical)
+		}
+	}
+	return result
+}
+
+// count returns how often the tags of a group are used
+func (i *Index) count(fold string) int {
+	total := 0
+	for _, count := range i.groups[fold] {
+		total += count
+	}
+	return total
+}
+
+// spelling returns the most used spelling of a group
+func (i *Index) spelling(fold string) string {
+	best, bestCount := "", 0
+	for spelling, count := range i.groups[fold] {
+		if count > bestCount || count == bestCount && spelling < best {
+			best, bestCount = spelling, count
+		}
+	}
+	return best
+}
+
+// foldKey removes the separators of every level, so machine-learning, MachineLearning
+// and machine_learning fold to the same key
+func foldKey(key string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(key)
+}
+
+// singulars returns the keys with the plural s of one level removed, so projects/notes
+// yields project/notes and projects/note
+func singulars(fold string) []string {
+	var result []string
+	levels := strings.Split(fold, "/")
+	for j, level := range levels {
+		if len(level) <= 3 || !strings.HasSuffix(level, "s") {
+			continue
+		}
+		singular := append([]string(nil), levels...)
+		singular[j] = strings.TrimSuffix(level, "s")
+		result = append(result, strings.Join(singular, "/"))
+	}
+	return result
+}
+
+// withinOneEdit reports whether a and b differ by at most one inserted, deleted or replaced
+// rune. An edited digit is never a typo, meeting-2024 and meeting-2025 are different tags.
+func withinOneEdit(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) > len(rb) {
+		ra, rb = rb, ra
+	}
+	if len(rb)-len(ra) > 1 {
+		return false
+	}
+	edits := 0
+	for x, y := 0, 0; x < len(ra) || y < len(rb); {
+		if x < len(ra) && y < len(rb) && ra[x] == rb[y] {
+			x++
+			y++
+			continue
+		}
+		edits++
+		if edits > 1 || unicode.IsDigit(rb[y]) {
+			return false
+		}
+		if len(ra) == len(rb) {
+			if unicode.IsDigit(ra[x]) {
+				return false
+			}
+			x++
+		}
+		y++
+	}
+	return true
+}
+
+var (
+	inlineTag  = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+	inlineCode = regexp.MustCompile("`[^`\n]*`")
+)
+
+// Extract returns the inline #tags of a Markdown body, ignoring code blocks and inline code
+func Extract(body string) []string {
+	var result []string
+	var fences fence.Scanner
+	for _, line := range strings.Split(body, "\n") {
+		if fences.Next(line) != fence.Text {
+			continue
+		}
+		line = inlineCode.ReplaceAllString(line, "")
+		for _, match := range inlineTag.FindAllStringSubmatch(line, -1) {
+			if tag, ok := Normalize(match[1]); ok {
+				result = append(result, tag)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexTop(t *testing.T) {
+	index := NewIndex()
+	index.Add("b", "a", "#A", "Machine-Learning", "machine-learning", "machine-learning", "2024")
+
+	if index.Len() != 3 {
+		t.Errorf("expected 3 tags, got %d", index.Len())
+	}
+	if got := index.Top(0); !reflect.DeepEqual(got, []string{"machine-learning", "A", "b"}) {
+		t.Errorf("unexpected top tags: %v", got)
+	}
+	if got := index.Top(1); !reflect.DeepEqual(got, []string{"machine-learning"}) {
+		t.Errorf("unexpected top tag: %v", got)
+	}
+}
+
+func TestIndexCanonical(t *testing.T) {
+	index := NewIndex()
+	index.Add("machine-learning", "machine-learning", "MachineLearning", "projects/obsidian", "note", "ai",
+		"meeting-2024", "meeting", "python3", "news", "projects/note")
+
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"Machine-Learning", "machine-learning", true},
+		{"machine_learning", "machine-learning", true},
+		{"#machine learning", "machine-learning", true},
+		{"machinelearnings", "machine-learning", true},
+		{"machine-lerning", "machine-learning", true},
+		{"Projects/Obsidian", "projects/obsidian", true},
+		{"notes", "note", true},
+		{"ml", "", false},
+		{"ai", "ai", true},
+		{"aix", "", false},
+		{"meeting-2025", "", false},
+		{"python2", "", false},
+		{"python", "", false},
+		{"new", "", false},
+		{"meetings", "meeting", true},
+		{"projects/notes", "projects/note", true},
+	}
+	for _, tt := range tests {
+		got, ok := index.Canonical(tt.input)
+		if ok != tt.ok || ok && got != tt.expected {
+			t.Errorf("Canonical(%q) = %q, %v, expected %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+
+	suggested := []string{"MachineLearning", "machine_learning", "new tag", "AI", "!!!"}
+	if got := index.Canonicalize(suggested, false); !reflect.DeepEqual(got, []string{"machine-learning", "new-tag", "ai"}) {
+		t.Errorf("unexpected canonicalized tags: %v", got)
+	}
+	if got := index.Canonicalize(suggested, true); !reflect.DeepEqual(got, []string{"machine-learning", "ai"}) {
+		t.Errorf("unexpected strictly canonicalized tags: %v", got)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	body := "# Heading\n" +
+		"Text with #tag and #nested/tag, not a#tag or #123.\n" +
+		"`#code` but #after-code\n" +
+		"```\n#in-block\n```\n" +
+		"#start"
+	expected := []string{"tag", "nested/tag", "after-code", "start"}
+	if got := Extract(body); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
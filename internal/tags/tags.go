@@ -0,0 +1,87 @@
+package tags
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize converts a tag into valid Obsidian tag syntax: no leading '#', no whitespace,
+// only letters, digits, '_', '-' and '/' for nested tags without empty levels.
+// ok is false if nothing valid remains, e.g. for purely numeric tags which Obsidian does not accept.
+func Normalize(tag string) (string, bool) {
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+
+	var b strings.Builder
+	lastDash := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '/':
+			b.WriteRune(r)
+			lastDash = false
+		case r == '-' || unicode.IsSpace(r) || r == '.' || r == ',' || r == ':':
+			if !lastDash && b.Len() > 0 {
+				b.WriteRune('-')
+				lastDash = true
+			}
+		}
+	}
+
+	var levels []string
+	for _, level := range strings.Split(b.String(), "/") {
+		if level = strings.Trim(level, "-"); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	normalized := strings.Join(levels, "/")
+
+	if strings.IndexFunc(normalized, func(r rune) bool { return !unicode.IsDigit(r) && r != '/' }) < 0 {
+		return "", false
+	}
+	return normalized, true
+}
+
+// Key returns the key tags are compared by, Obsidian treats tags case-insensitively
+func Key(tag string) string {
+	return strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+}
+
+// Merge unions the normalized AI tags into the existing tags, which are kept as they are.
+// Tags equal to an existing one ignoring case are not added again. It returns the merged
+// list and the tags which were added, so they can be removed again later.
+func Merge(existing, ai []string) (merged, added []string) {
+	seen := map[string]bool{}
+	for _, tag := range existing {
+		key := Key(tag)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, tag)
+	}
+
+	for _, tag := range ai {
+		normalized, ok := Normalize(tag)
+		if !ok || seen[Key(normalized)] {
+			continue
+		}
+		seen[Key(normalized)] = true
+		merged = append(merged, normalized)
+		added = append(added, normalized)
+	}
+	return merged, added
+}
+
+// Remove returns tags without the ones in remove, compared ignoring case
+func Remove(tags, remove []string) []string {
+	drop := map[string]bool{}
+	for _, tag := range remove {
+		drop[Key(tag)] = true
+	}
+	var result []string
+	for _, tag := range tags {
+		if !drop[Key(tag)] {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package tags
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		ok       bool
+	}{
+		{"tag", "tag", true},
+		{"#tag", "tag", true},
+		{"  ##Machine Learning  ", "Machine-Learning", true},
+		{"#foo: bar", "foo-bar", true},
+		{"projects/2024", "projects/2024", true},
+		{"/a//b/", "a/b", true},
+		{"a / b", "a/b", true},
+		{"c++", "c", true},
+		{"Künstliche Intelligenz", "Künstliche-Intelligenz", true},
+		{"機械学習", "機械学習", true},
+		{"snake_case", "snake_case", true},
+		{"v1.2", "v1-2", true},
+		{"2024", "", false},
+		{"#", "", false},
+		{"!!!", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := Normalize(tt.input)
+		if got != tt.expected || ok != tt.ok {
+			t.Errorf("Normalize(%q) = %q, %v, expected %q, %v", tt.input, got, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name           string
+		existing       []string
+		ai             []string
+		expectedMerged []string
+		expectedAdded  []string
+	}{
+		{
+			name:           "Union without duplicates",
+			existing:       []string{"Project", "#inbox"},
+			ai:             []string{"project", "Inbox", "new tag", "#Other"},
+			expectedMerged: []string{"Project", "#inbox", "new-tag", "Other"},
+			expectedAdded:  []string{"new-tag", "Other"},
+		},
+		{
+			name:           "No existing tags",
+			ai:             []string{"a", "A", "2024", "b"},
+			expectedMerged: []string{"a", "b"},
+			expectedAdded:  []string{"a", "b"},
+		},
+		{
+			name:           "Duplicate existing tags are collapsed",
+			existing:       []string{"a", "A"},
+			expectedMerged: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, added := Merge(tt.existing, tt.ai)
+			if !reflect.DeepEqual(merged, tt.expectedMerged) {
+				t.Errorf("merged: expected %v, got %v", tt.expectedMerged, merged)
+			}
+			if !reflect.DeepEqual(added, tt.expectedAdded) {
+				t.Errorf("added: expected %v, got %v", tt.expectedAdded, added)
+			}
+		})
+	}
+}
+
+func TestRemove(t *testing.T) {
+	got := Remove([]string{"a", "B", "#c"}, []string{"b", "C"})
+	if !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("expected [a], got %v", got)
+	}
+}